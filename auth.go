@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scopes that can be granted to API keys and tokens.
+const (
+	// scopeRead allows reading public webcams and the private webcams listed in the grant.
+	scopeRead = "read"
+	// scopeAdmin allows everything, including reading all private webcams.
+	scopeAdmin = "admin"
+)
+
+// AuthConfig configures the authentication of API clients.
+type AuthConfig struct {
+	// Required rejects requests without credentials. Otherwise anonymous
+	// clients can read public webcams.
+	Required bool `json:"required"`
+	// TokenSecret is the key used to sign bearer tokens. Tokens are disabled if empty.
+	TokenSecret string `json:"tokenSecret"`
+	// Keys are the static API keys accepted by the server.
+	Keys []APIKey `json:"keys"`
+}
+
+// An APIKey is a static secret granting access to the API.
+type APIKey struct {
+	Key   string `json:"key"`
+	Grant Grant  `json:"grant"`
+}
+
+// A Grant describes what a client can access.
+type Grant struct {
+	Subject string `json:"sub"`
+	Scope   string `json:"scope"`
+	// Webcams lists the private webcams visible with the read scope.
+	Webcams []int `json:"webcams,omitempty"`
+}
+
+// HasScope tells whether the grant includes a scope. The admin scope includes all others.
+func (g *Grant) HasScope(scope string) bool {
+	return g != nil && (g.Scope == scope || g.Scope == scopeAdmin)
+}
+
+// CanSee tells whether a webcam is visible with the grant. A nil grant represents
+// an anonymous client, who can only see public webcams.
+func (g *Grant) CanSee(w *Webcam) bool {
+	if !w.Private || g.HasScope(scopeAdmin) {
+		return true
+	}
+
+	if !g.HasScope(scopeRead) {
+		return false
+	}
+
+	for _, id := range g.Webcams {
+		if id == w.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tokenClaims are the content of a signed bearer token.
+type tokenClaims struct {
+	Grant
+	Expires int64 `json:"exp"`
+}
+
+// SignToken creates a bearer token for a grant, valid until the given time.
+// Tokens are made of base64url-encoded JSON claims and their HMAC-SHA256
+// signature, separated by a dot.
+func SignToken(secret string, grant Grant, expires time.Time) (string, error) {
+	if secret == "" {
+		return "", errors.New("No token secret configured")
+	}
+
+	claims, err := json.Marshal(tokenClaims{grant, expires.Unix()})
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + signPayload(secret, payload), nil
+}
+
+func signPayload(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// An Authenticator identifies API clients from their API key or bearer token.
+type Authenticator struct {
+	config    AuthConfig
+	now       func() time.Time
+	anonymous map[string]bool
+}
+
+// NewAuthenticator creates an Authenticator with the given configuration.
+func NewAuthenticator(config AuthConfig) *Authenticator {
+	return &Authenticator{config, time.Now, make(map[string]bool)}
+}
+
+// AllowAnonymous lets anonymous clients use the named routes even when
+// credentials are required, such as the routes serving static files.
+func (a *Authenticator) AllowAnonymous(routes ...string) {
+	for _, name := range routes {
+		a.anonymous[name] = true
+	}
+}
+
+type grantContextKey struct{}
+
+// GrantFromRequest returns the grant of the client that made the request,
+// or nil for anonymous clients.
+func GrantFromRequest(r *http.Request) *Grant {
+	grant, _ := r.Context().Value(grantContextKey{}).(*Grant)
+	return grant
+}
+
+var errUnauthorized = errors.New("Invalid or missing credentials")
+
+// Middleware authenticates requests and makes their grant available with GrantFromRequest.
+// Credentials are read from the X-API-Key header or from an Authorization bearer
+// header, which can contain an API key or a signed token.
+func (a *Authenticator) Middleware(next Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+		credentials := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); credentials == "" && auth != "" {
+			if !strings.HasPrefix(auth, "Bearer ") {
+				return a.unauthorized(w)
+			}
+			credentials = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+
+		if credentials == "" {
+			if a.config.Required && !a.anonymous[RouteName(r)] {
+				return a.unauthorized(w)
+			}
+			return next(w, r, p)
+		}
+
+		grant, err := a.authenticate(credentials)
+		if err != nil {
+			return a.unauthorized(w)
+		}
+
+		return next(w, r.WithContext(context.WithValue(r.Context(), grantContextKey{}, grant)), p)
+	}
+}
+
+func (a *Authenticator) unauthorized(w http.ResponseWriter) error {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="webcams"`)
+	return StatusError{http.StatusUnauthorized, errUnauthorized}
+}
+
+// authenticate returns the grant of an API key or a signed token.
+func (a *Authenticator) authenticate(credentials string) (*Grant, error) {
+	// Compare with all keys in constant time, not to leak valid keys through timing
+	var found *Grant
+	for i, k := range a.config.Keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(credentials)) == 1 && k.Key != "" {
+			found = &a.config.Keys[i].Grant
+		}
+	}
+
+	if found != nil {
+		return found, nil
+	}
+
+	return a.verifyToken(credentials)
+}
+
+// verifyToken checks the signature and expiration of a token and returns its grant.
+func (a *Authenticator) verifyToken(token string) (*Grant, error) {
+	if a.config.TokenSecret == "" {
+		return nil, errUnauthorized
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, errUnauthorized
+	}
+
+	expected := signPayload(a.config.TokenSecret, parts[0])
+	if !hmac.Equal([]byte(parts[1]), []byte(expected)) {
+		return nil, errUnauthorized
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	claims := tokenClaims{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, errUnauthorized
+	}
+
+	if a.now().Unix() >= claims.Expires {
+		return nil, errors.New("Token expired")
+	}
+
+	return &claims.Grant, nil
+}
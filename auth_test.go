@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newAuthTestRouter(config AuthConfig) *Router {
+	controller := &WebcamController{}
+	controller.SetWebcams([]Webcam{
+		Webcam{ID: 1, Name: "Public"},
+		Webcam{ID: 2, Name: "Private", Private: true},
+		Webcam{ID: 3, Name: "Secret", Private: true},
+	})
+
+	router := NewRouter(nil)
+	router.Use(NewAuthenticator(config).Middleware)
+	router.Mount("/webcam", controller)
+
+	return router
+}
+
+// visibleWebcams returns the ids of the webcams listed with the given credentials, or nil on error.
+func visibleWebcams(router *Router, header string, value string) []int {
+	req := httptest.NewRequest("GET", "/webcam", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		return nil
+	}
+
+	webcams := []Webcam{}
+	json.Unmarshal(rec.Body.Bytes(), &webcams)
+
+	ids := []int{}
+	for _, w := range webcams {
+		ids = append(ids, w.ID)
+	}
+	return ids
+}
+
+func TestAuthAPIKeysAndTokens(t *testing.T) {
+	config := AuthConfig{
+		TokenSecret: "secret",
+		Keys: []APIKey{
+			APIKey{"reader", Grant{Subject: "map", Scope: scopeRead, Webcams: []int{2}}},
+			APIKey{"admin", Grant{Subject: "ops", Scope: scopeAdmin}},
+		},
+	}
+	router := newAuthTestRouter(config)
+
+	valid, _ := SignToken("secret", Grant{Subject: "app", Scope: scopeRead, Webcams: []int{3}}, time.Now().Add(time.Hour))
+	expired, _ := SignToken("secret", Grant{Subject: "app", Scope: scopeAdmin}, time.Now().Add(-time.Hour))
+	forged, _ := SignToken("other", Grant{Subject: "app", Scope: scopeAdmin}, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		header   string
+		value    string
+		expected []int
+	}{
+		{"", "", []int{1}},
+		{"X-API-Key", "reader", []int{1, 2}},
+		{"Authorization", "Bearer reader", []int{1, 2}},
+		{"Authorization", "Bearer admin", []int{1, 2, 3}},
+		{"Authorization", "Bearer " + valid, []int{1, 3}},
+		{"Authorization", "Bearer " + expired, nil},
+		{"Authorization", "Bearer " + forged, nil},
+		{"Authorization", "Basic cmVhZGVyOg==", nil},
+		{"X-API-Key", "unknown", nil},
+	}
+
+	for _, test := range tests {
+		ids := visibleWebcams(router, test.header, test.value)
+		if (ids == nil) != (test.expected == nil) || len(ids) != len(test.expected) {
+			t.Errorf("%s %s: expected %v, got %v\n", test.header, test.value, test.expected, ids)
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] != test.expected[i] {
+				t.Errorf("%s %s: expected %v, got %v\n", test.header, test.value, test.expected, ids)
+			}
+		}
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	router := newAuthTestRouter(AuthConfig{
+		Required: true,
+		Keys:     []APIKey{APIKey{"reader", Grant{Scope: scopeRead}}},
+	})
+
+	req := httptest.NewRequest("GET", "/webcam", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != 401 || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected 401 with WWW-Authenticate header, got %d\n", rec.Code)
+	}
+
+	if ids := visibleWebcams(router, "X-API-Key", "reader"); len(ids) != 1 {
+		t.Errorf("Expected the public webcam with a key, got %v\n", ids)
+	}
+}
+
+func TestAuthPrivateWebcamNotFound(t *testing.T) {
+	router := newAuthTestRouter(AuthConfig{
+		Keys: []APIKey{APIKey{"reader", Grant{Scope: scopeRead, Webcams: []int{2}}}},
+	})
+
+	tests := []struct {
+		path     string
+		key      string
+		expected int
+	}{
+		{"/webcam/2/hist", "", 404},
+		{"/webcam/2/hist", "reader", 200},
+		{"/webcam/3/hist", "reader", 404},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.key != "" {
+			req.Header.Set("X-API-Key", test.key)
+		}
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != test.expected {
+			t.Errorf("%s with key %q: expected %d, got %d\n", test.path, test.key, test.expected, rec.Code)
+		}
+	}
+}
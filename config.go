@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Config contains the settings of the server that are not specific to a webcam.
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	Auth      AuthConfig      `json:"auth"`
+	Fetch     FetchConfig     `json:"fetch"`
+	RateLimit RateLimitConfig `json:"rateLimit"`
+	CORS      CORSConfig      `json:"cors"`
+}
+
+// loadConfig reads the configuration file. A missing file results in the default configuration.
+func loadConfig(filename string) Config {
+	config := Config{}
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return config
+	}
+	if err != nil {
+		panic("Could not read configuration file " + filename)
+	}
+
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&config); err != nil {
+		panic("Invalid configuration file " + filename + ": " + err.Error())
+	}
+
+	return config
+}
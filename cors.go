@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Headers that browsers can send in cross-origin requests by default,
+// which include the headers carrying credentials.
+var defaultCORSHeaders = []string{"Authorization", "Content-Type", "X-API-Key"}
+
+// CORSConfig configures the responses to cross-origin requests from browsers.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins, such as https://example.com, that can
+	// make cross-origin requests. "*" allows any origin. CORS is disabled if empty.
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// AllowedMethods restricts the methods allowed in cross-origin requests.
+	// All the methods handled on a path are allowed if empty.
+	AllowedMethods []string `json:"allowedMethods"`
+	// AllowedHeaders lists the request headers allowed in cross-origin requests,
+	// the headers used for authentication if empty.
+	AllowedHeaders []string `json:"allowedHeaders"`
+	// ExposedHeaders lists the response headers that browsers expose to scripts.
+	ExposedHeaders []string `json:"exposedHeaders"`
+	// AllowCredentials lets browsers send cookies and authorization headers.
+	AllowCredentials bool `json:"allowCredentials"`
+	// MaxAge is the number of seconds during which preflight responses can be cached.
+	MaxAge int `json:"maxAge"`
+}
+
+// SetCORS enables the responses to cross-origin requests. Preflight requests are
+// answered with the methods handled on the requested path, without calling the
+// middleware of the router since browsers send them without credentials.
+func (r *Router) SetCORS(config CORSConfig) {
+	if len(config.AllowedOrigins) == 0 {
+		r.cors = nil
+		return
+	}
+
+	if len(config.AllowedHeaders) == 0 {
+		config.AllowedHeaders = defaultCORSHeaders
+	}
+
+	r.cors = &config
+}
+
+// allowedOrigin returns the value of the Access-Control-Allow-Origin header
+// for the origin of a request, or an empty string if the origin is not allowed.
+func (c *CORSConfig) allowedOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+
+	for _, o := range c.AllowedOrigins {
+		// Browsers refuse credentials with a wildcard origin
+		if o == "*" && !c.AllowCredentials {
+			return "*"
+		}
+		if o == "*" || o == origin {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+// isPreflight tells whether a request is a CORS preflight request.
+func isPreflight(req *http.Request) bool {
+	return req.Method == "OPTIONS" && req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// setHeaders adds the CORS headers to the response to a request from an allowed
+// origin. It returns false if the origin is not allowed.
+func (c *CORSConfig) setHeaders(w http.ResponseWriter, req *http.Request) bool {
+	// Responses differ by origin, caches must not share them
+	w.Header().Add("Vary", "Origin")
+
+	origin := c.allowedOrigin(req.Header.Get("Origin"))
+	if origin == "" {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	return true
+}
+
+// exposeHeaders adds the headers of a response to a request that is not a preflight request.
+func (c *CORSConfig) exposeHeaders(w http.ResponseWriter, req *http.Request) {
+	if c.setHeaders(w, req) && len(c.ExposedHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+	}
+}
+
+// preflight answers a preflight request on a path handling the given methods.
+func (c *CORSConfig) preflight(w http.ResponseWriter, req *http.Request, methods []string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+
+	if c.setHeaders(w, req) {
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.filterMethods(methods), ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+		if c.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// filterMethods returns the methods that are allowed in cross-origin requests.
+func (c *CORSConfig) filterMethods(methods []string) []string {
+	if len(c.AllowedMethods) == 0 {
+		return methods
+	}
+
+	filtered := []string{}
+	for _, m := range methods {
+		for _, allowed := range c.AllowedMethods {
+			if strings.EqualFold(m, allowed) {
+				filtered = append(filtered, m)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
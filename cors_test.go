@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func newCORSTestRouter(config CORSConfig) *Router {
+	router := NewRouter(nil)
+	router.Use(NewAuthenticator(AuthConfig{Required: true, Keys: []APIKey{APIKey{"key", Grant{Scope: scopeRead}}}}).Middleware)
+	router.Mount("/webcam", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/", Handler: helloHandler},
+			Route{Method: "GET", Path: "/:id", Handler: helloHandler},
+			Route{Method: "DELETE", Path: "/:id", Handler: helloHandler},
+		},
+	})
+	router.SetCORS(config)
+
+	return router
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newCORSTestRouter(CORSConfig{
+		AllowedOrigins:   []string{"https://map.example.com"},
+		AllowedMethods:   []string{"GET", "HEAD", "OPTIONS"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})
+
+	tests := []struct {
+		path    string
+		origin  string
+		code    int
+		origins string
+		methods string
+	}{
+		{"/webcam", "https://map.example.com", 204, "https://map.example.com", "GET, HEAD, OPTIONS"},
+		{"/webcam/1", "https://map.example.com", 204, "https://map.example.com", "GET, HEAD, OPTIONS"},
+		{"/webcam/1", "https://evil.example.com", 204, "", ""},
+		// No route matches, the request is not a preflight for an existing resource
+		{"/other", "https://map.example.com", 401, "https://map.example.com", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("OPTIONS", test.path, nil)
+		req.Header.Set("Origin", test.origin)
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		req.Header.Set("Access-Control-Request-Headers", "x-api-key")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		h := rec.Header()
+		if rec.Code != test.code || h.Get("Access-Control-Allow-Origin") != test.origins || h.Get("Access-Control-Allow-Methods") != test.methods {
+			t.Errorf("%s from %s: expected %d %q %q, got %d %q %q\n", test.path, test.origin, test.code, test.origins, test.methods,
+				rec.Code, h.Get("Access-Control-Allow-Origin"), h.Get("Access-Control-Allow-Methods"))
+		}
+
+		if test.code == 204 && test.origins != "" {
+			if h.Get("Access-Control-Allow-Headers") != "Authorization, Content-Type, X-API-Key" || h.Get("Access-Control-Max-Age") != "600" || h.Get("Access-Control-Allow-Credentials") != "true" {
+				t.Errorf("%s: unexpected preflight headers %v\n", test.path, h)
+			}
+		}
+	}
+}
+
+func TestCORSRequests(t *testing.T) {
+	router := newCORSTestRouter(CORSConfig{
+		AllowedOrigins: []string{"*"},
+		ExposedHeaders: []string{"Retry-After"},
+	})
+
+	tests := []struct {
+		key    string
+		origin string
+		code   int
+		allow  string
+	}{
+		{"key", "https://map.example.com", 200, "*"},
+		// Error responses can be read by scripts too
+		{"", "https://map.example.com", 401, "*"},
+		{"key", "", 200, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/webcam/1", nil)
+		req.Header.Set("X-API-Key", test.key)
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		h := rec.Header()
+		if rec.Code != test.code || h.Get("Access-Control-Allow-Origin") != test.allow || h.Get("Vary") != "Origin" {
+			t.Errorf("%q from %q: expected %d %q, got %d %v\n", test.key, test.origin, test.code, test.allow, rec.Code, h)
+		}
+		if test.allow != "" && h.Get("Access-Control-Expose-Headers") != "Retry-After" {
+			t.Errorf("Expected exposed headers, got %v\n", h)
+		}
+	}
+
+	// Without CORS, OPTIONS requests are answered by the router after the middleware
+	router.SetCORS(CORSConfig{})
+	req := httptest.NewRequest("OPTIONS", "/webcam/1", nil)
+	req.Header.Set("Origin", "https://map.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != 401 || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected CORS to be disabled, got %d %v\n", rec.Code, rec.Header())
+	}
+}
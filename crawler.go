@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +11,9 @@ import (
 	"time"
 )
 
+// Format of the timestamps used to name stored images.
+const defaultTimeFormat = time.RFC3339
+
 // A Crawler crawls webcam images at the interval specified
 // in Webcam structs and saves them in a local folder.
 type Crawler struct {
@@ -27,7 +31,7 @@ func NewCralwer(webcams []Webcam, storagePath string) *Crawler {
 		&http.Client{},
 		storagePath,
 		make([]chan struct{}, 0),
-		time.RFC3339,
+		defaultTimeFormat,
 	}
 }
 
@@ -45,8 +49,15 @@ func (c *Crawler) Stop() {
 	}
 }
 
+// scheduleCrawl fetches the images of a webcam at the times of its schedule.
 func (c *Crawler) scheduleCrawl(w Webcam) {
-	if w.CrawlInterval() <= 0 {
+	schedule, err := w.schedule()
+	if err != nil {
+		fmt.Printf("Invalid schedule for webcam %s: %s\n", w.Name, err)
+		return
+	}
+
+	if schedule == nil {
 		// Crawling is disabled for this webcam
 		return
 	}
@@ -54,17 +65,36 @@ func (c *Crawler) scheduleCrawl(w Webcam) {
 	stopChan := make(chan struct{})
 	c.stopChans = append(c.stopChans, stopChan)
 
-	ticker := time.NewTicker(w.CrawlInterval())
-
 	go func() {
-		for {
+		next := schedule.Next(time.Now())
+		for !next.IsZero() {
+			timer := time.NewTimer(time.Until(next))
+
 			select {
-			case <-ticker.C:
-				c.crawl(w)
+			case <-timer.C:
 			case <-stopChan:
-				ticker.Stop()
+				timer.Stop()
 				return
 			}
+
+			// Do not fetch if the crawler was stopped while the timer fired
+			select {
+			case <-stopChan:
+				return
+			default:
+				c.crawl(w)
+			}
+
+			// Follow the schedule without drifting. Like a ticker, fetch immediately
+			// if fetching took longer than the interval, skipping the other missed fetches.
+			next = schedule.Next(next)
+			for now := time.Now(); !next.IsZero(); {
+				following := schedule.Next(next)
+				if following.IsZero() || following.After(now) {
+					break
+				}
+				next = following
+			}
 		}
 	}()
 }
@@ -72,15 +102,21 @@ func (c *Crawler) scheduleCrawl(w Webcam) {
 func (c *Crawler) crawl(w Webcam) {
 	now := time.Now()
 
-	image, err := w.getImage(c.client)
+	image, contentType, err := w.getImageContext(context.Background(), c.client)
 	if err != nil {
 		fmt.Printf("Could not get image for webcam %s: %s\n", w.Name, err) // TODO: replace with proper logging
 		return
 	}
 
+	image, extension, err := encodeForStorage(image, contentType, w)
+	if err != nil {
+		fmt.Printf("Could not encode image for webcam %s: %s\n", w.Name, err)
+		return
+	}
+
 	dirname := filepath.Join(c.storagePath, strconv.Itoa(w.ID))
 	os.MkdirAll(dirname, os.ModePerm)
-	filename := filepath.Join(dirname, now.Format(c.format)+".jpg")
+	filename := filepath.Join(dirname, now.Format(c.format)+extension)
 
 	err = ioutil.WriteFile(filename, image, 0644)
 	if err != nil {
@@ -113,13 +149,20 @@ func (c *Crawler) cleanupDir(dirname string, maxAge time.Duration) {
 			}
 		}
 	}
+
+	pruneThumbnails(dirname)
 }
 
 func (c *Crawler) timeFromName(name string) (time.Time, error) {
+	return frameTime(name, c.format)
+}
+
+// frameTime parses the creation time of a stored image from its file name.
+func frameTime(name string, format string) (time.Time, error) {
 	var extension = filepath.Ext(name)
 	var dateString = name[0 : len(name)-len(extension)]
 
-	creation, err := time.Parse(c.format, dateString)
+	creation, err := time.Parse(format, dateString)
 	if err != nil {
 		return time.Time{}, err
 	}
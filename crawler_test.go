@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"image"
+	"image/jpeg"
 	"io/ioutil"
+	"math/rand"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
@@ -17,20 +22,20 @@ func TestCrawler(t *testing.T) {
 
 	webcams := []Webcam{
 		Webcam{
-			1,
-			"Les Paccots",
-			addr,
-			Coordinate{46.123, 6.66},
-			"3ms",
-			"5ms",
+			ID:                  1,
+			Name:                "Les Paccots",
+			URL:                 addr,
+			Position:            Coordinate{46.123, 6.66},
+			CrawlIntervalString: "3ms",
+			MaxAgeString:        "5ms",
 		},
 		Webcam{
-			2,
-			"La Fouly",
-			addr,
-			Coordinate{46.123, 6.66},
-			"0",
-			"5ms",
+			ID:                  2,
+			Name:                "La Fouly",
+			URL:                 addr,
+			Position:            Coordinate{46.123, 6.66},
+			CrawlIntervalString: "0",
+			MaxAgeString:        "5ms",
 		}}
 
 	storagePath := "test-storage"
@@ -60,3 +65,106 @@ func TestCrawler(t *testing.T) {
 
 	os.RemoveAll(storagePath)
 }
+
+func TestCrawlerStorageFormat(t *testing.T) {
+	server := httptest.NewServer(testHandler{})
+	defer server.Close()
+
+	storagePath := "test-storage-format"
+	defer os.RemoveAll(storagePath)
+
+	c := NewCralwer(nil, storagePath)
+	c.client = server.Client()
+	c.format = time.RFC3339Nano
+
+	url := "http://" + server.Listener.Addr().String()
+	c.crawl(Webcam{ID: 1, URL: url, MaxAgeString: "1h"})
+	c.crawl(Webcam{ID: 2, URL: url, MaxAgeString: "1h", StorageFormat: "jpeg", JPEGQuality: 90})
+
+	expected := map[string]string{"1": ".png", "2": ".jpg"}
+	for id, ext := range expected {
+		files, err := ioutil.ReadDir(filepath.Join(storagePath, id))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("Expected one stored file for webcam %s\n", id)
+		}
+
+		name := files[0].Name()
+		if filepath.Ext(name) != ext {
+			t.Errorf("Expected extension %s for webcam %s, got %s\n", ext, id, name)
+		}
+
+		data, _ := ioutil.ReadFile(filepath.Join(storagePath, id, name))
+		if format, _ := detectImageFormat(data); imageExtensions[format] != ext {
+			t.Errorf("Stored file %s has format %s\n", name, format)
+		}
+	}
+
+	// Images whose format cannot be detected are only stored in their original format
+	unknown := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		w.Write([]byte("not an image"))
+	}))
+	defer unknown.Close()
+
+	url = "http://" + unknown.Listener.Addr().String()
+	c.crawl(Webcam{ID: 3, URL: url, MaxAgeString: "1h"})
+	c.crawl(Webcam{ID: 4, URL: url, MaxAgeString: "1h", StorageFormat: "png"})
+
+	if files, err := ioutil.ReadDir(filepath.Join(storagePath, "3")); err != nil || len(files) != 1 || filepath.Ext(files[0].Name()) != ".gif" {
+		t.Errorf("Expected one stored .gif file for webcam 3\n")
+	}
+	if files, _ := ioutil.ReadDir(filepath.Join(storagePath, "4")); len(files) != 0 {
+		t.Errorf("Expected no stored file for webcam 4, got %d\n", len(files))
+	}
+
+	// Formats that cannot be labelled are not stored
+	if _, _, err := encodeForStorage([]byte("not an image"), "image/x-unknown", Webcam{}); err == nil {
+		t.Errorf("Expected an error for an unknown content type\n")
+	}
+
+	tests := []struct {
+		contentType string
+		expected    string
+	}{
+		{"image/png", ".png"},
+		{"image/jpeg; charset=binary", ".jpg"},
+		{"image/webp", ".webp"},
+		{"image/x-unknown", ""},
+		{"text/gif", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if ext, ok := extensionFromContentType(test.contentType); ext != test.expected || ok != (test.expected != "") {
+			t.Errorf("%q: expected extension %q, got %q\n", test.contentType, test.expected, ext)
+		}
+	}
+
+	if ct := contentTypeFromName("2026-10-17T08:00:00Z.webp"); ct != "image/webp" {
+		t.Errorf("Expected image/webp for a stored WebP image, got %s\n", ct)
+	}
+}
+
+func TestEncodeJPEGForStorage(t *testing.T) {
+	// A noisy image, so that the quality changes the size of the JPEG
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	random := rand.New(rand.NewSource(1))
+	random.Read(img.Pix)
+
+	buf := new(bytes.Buffer)
+	jpeg.Encode(buf, img, &jpeg.Options{Quality: 100})
+	original := buf.Bytes()
+
+	data, ext, err := encodeForStorage(original, "image/jpeg", Webcam{StorageFormat: storeJPEG, JPEGQuality: 30})
+	if err != nil || ext != ".jpg" {
+		t.Fatalf("Expected a JPEG image, got %s %v\n", ext, err)
+	}
+	if len(data) >= len(original) {
+		t.Errorf("Expected the JPEG image to be re-encoded, got %d bytes from %d\n", len(data), len(original))
+	}
+
+	// Without quality, JPEG images are kept as is
+	if data, _, _ := encodeForStorage(original, "image/jpeg", Webcam{StorageFormat: storeJPEG}); !bytes.Equal(data, original) {
+		t.Errorf("Expected the original JPEG image\n")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const (
+	// Default maximum size of an image fetched from a webcam.
+	maxImageSize = 32 << 20
+
+	// Absolute maximum size of an image, also enforced with HTTP clients not
+	// created by NewFetchClient.
+	absoluteMaxImageSize = 1 << 30
+
+	// Default maximum number of redirects followed when fetching an image.
+	defaultMaxRedirects = 3
+
+	// Default timeout of a request to a webcam.
+	defaultFetchTimeout = 30 * time.Second
+)
+
+// FetchConfig configures the HTTP client used to fetch webcam images.
+type FetchConfig struct {
+	// Allow lists CIDR ranges that can be fetched even though they are blocked by default.
+	Allow []string `json:"allow"`
+	// MaxRedirects is the maximum number of redirects followed, 0 meaning the default.
+	MaxRedirects int `json:"maxRedirects"`
+	// MaxImageSize is the maximum size of a response body in bytes, 0 meaning
+	// the default of 32 MiB. It cannot exceed 1 GiB.
+	MaxImageSize int64 `json:"maxImageSize"`
+	// Timeout is the maximum duration of a request, such as 10s.
+	Timeout string `json:"timeout"`
+}
+
+// Ranges of addresses that cannot be fetched unless allowed: the local host,
+// private networks and link-local addresses, which include cloud metadata services.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks, err := parseCIDRs(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlockedIP tells whether an address is blocked and not explicitly allowed.
+func isBlockedIP(ip net.IP, allowed []*net.IPNet) bool {
+	// Check IPv4-mapped IPv6 addresses as IPv4 addresses
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	return containsIP(blockedNetworks, ip) && !containsIP(allowed, ip)
+}
+
+// NewFetchClient creates an HTTP client that refuses to connect to blocked
+// addresses, follows a limited number of redirects and limits the size of responses.
+// Addresses are checked when connecting, after name resolution, so that names
+// resolving to blocked addresses are refused too.
+func NewFetchClient(config FetchConfig) (*http.Client, error) {
+	allowed, err := parseCIDRs(config.Allow)
+	if err != nil {
+		return nil, errors.New("Invalid allowed range: " + err.Error())
+	}
+
+	maxRedirects := config.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	maxSize := config.MaxImageSize
+	if maxSize <= 0 {
+		maxSize = maxImageSize
+	}
+	if maxSize > absoluteMaxImageSize {
+		return nil, fmt.Errorf("Maximum image size of %d bytes exceeds the limit of %d bytes", maxSize, absoluteMaxImageSize)
+	}
+
+	timeout := defaultFetchTimeout
+	if config.Timeout != "" {
+		if timeout = myParseDuration(config.Timeout); timeout <= 0 {
+			return nil, errors.New("Invalid fetch timeout " + config.Timeout)
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || isBlockedIP(ip, allowed) {
+				return errors.New("Connection to " + host + " is not allowed")
+			}
+
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		// Never use a proxy, which would bypass the address checks
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: limitedTransport{transport, maxSize},
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("Stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("Redirect to unsupported scheme " + req.URL.Scheme)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// A limitedTransport fails reading responses larger than a maximum size.
+type limitedTransport struct {
+	transport http.RoundTripper
+	maxSize   int64
+}
+
+func (t limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.ContentLength > t.maxSize {
+		res.Body.Close()
+		return nil, fmt.Errorf("Response of %d bytes exceeds the maximum of %d bytes", res.ContentLength, t.maxSize)
+	}
+
+	res.Body = &limitedBody{res.Body, t.maxSize}
+	return res, nil
+}
+
+// A limitedBody returns an error once more than max bytes have been read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+var errResponseTooLarge = errors.New("Response exceeds the maximum size")
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errResponseTooLarge
+	}
+
+	// Read one byte more than allowed to detect larger responses
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, errResponseTooLarge
+	}
+
+	return n, err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsBlockedIP(t *testing.T) {
+	allowed := mustParseCIDRs("192.168.1.0/24")
+
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.20.0.1", true},
+		{"192.168.0.10", true},
+		{"192.168.1.10", false},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"::", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+	}
+
+	for _, test := range tests {
+		if isBlockedIP(net.ParseIP(test.ip), allowed) != test.blocked {
+			t.Errorf("%s: expected blocked=%t\n", test.ip, test.blocked)
+		}
+	}
+}
+
+func TestFetchClientBlocksLocalAddresses(t *testing.T) {
+	server := httptest.NewServer(testHandler{})
+	defer server.Close()
+
+	webcam := &Webcam{URL: server.URL}
+
+	client, _ := NewFetchClient(FetchConfig{})
+	if _, err := webcam.getImage(client); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected connection to %s to be refused, got %v\n", server.URL, err)
+	}
+
+	client, _ = NewFetchClient(FetchConfig{Allow: []string{"127.0.0.0/8"}})
+	if img, err := webcam.getImage(client); err != nil || !compare(img, imageData) {
+		t.Errorf("Expected allowed connection to succeed, got %v\n", err)
+	}
+
+	if _, err := NewFetchClient(FetchConfig{Allow: []string{"invalid"}}); err == nil {
+		t.Errorf("Expected an error for an invalid range\n")
+	}
+}
+
+func TestFetchClientLimits(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		// Stream the body without Content-Length
+		w.(http.Flusher).Flush()
+		w.Write(make([]byte, 2048))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, maxImageSize+1))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/image", http.StatusFound)
+	})
+	mux.Handle("/image", testHandler{})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, _ := NewFetchClient(FetchConfig{Allow: []string{"127.0.0.0/8"}, MaxRedirects: 2, MaxImageSize: 1024})
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"/image", true},
+		{"/redirect", true},
+		{"/loop", false},
+		{"/large", false},
+	}
+
+	for _, test := range tests {
+		webcam := &Webcam{URL: server.URL + test.path}
+		_, err := webcam.getImage(client)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: expected success=%t, got %v\n", test.path, test.ok, err)
+		}
+	}
+
+	// The configured size can exceed the default
+	client, _ = NewFetchClient(FetchConfig{Allow: []string{"127.0.0.0/8"}, MaxImageSize: 2 * maxImageSize})
+	if img, err := (&Webcam{URL: server.URL + "/huge"}).getImage(client); err != nil || len(img) != maxImageSize+1 {
+		t.Errorf("Expected an image larger than the default maximum size, got %v\n", err)
+	}
+
+	if _, err := NewFetchClient(FetchConfig{MaxImageSize: absoluteMaxImageSize + 1}); err == nil {
+		t.Errorf("Expected an error for a maximum size above the limit\n")
+	}
+}
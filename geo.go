@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Mean radius of the Earth, in kilometers.
+	earthRadius = 6371.0
+
+	// Size of the cells of the spatial index, in degrees.
+	gridCellSize = 1.0
+)
+
+// distance returns the great-circle distance between two coordinates in
+// kilometers, computed with the haversine formula.
+func distance(a Coordinate, b Coordinate) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// A boundingBox is a rectangle of coordinates. MinLon is greater than MaxLon
+// for boxes crossing the antimeridian.
+type boundingBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+func (b boundingBox) contains(c Coordinate) bool {
+	if c.Lat < b.MinLat || c.Lat > b.MaxLat {
+		return false
+	}
+
+	if b.MinLon <= b.MaxLon {
+		return c.Lon >= b.MinLon && c.Lon <= b.MaxLon
+	}
+	return c.Lon >= b.MinLon || c.Lon <= b.MaxLon
+}
+
+// circleBox returns a bounding box containing the circle of the given radius in kilometers.
+func circleBox(center Coordinate, radius float64) boundingBox {
+	dLat := radius / earthRadius * 180 / math.Pi
+	box := boundingBox{-180, center.Lat - dLat, 180, center.Lat + dLat}
+
+	// Near the poles the circle can contain all longitudes
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat, box.MaxLat = math.Max(box.MinLat, -90), math.Min(box.MaxLat, 90)
+		return box
+	}
+
+	ratio := math.Sin(radius/earthRadius) / math.Cos(center.Lat*math.Pi/180)
+	if radius/earthRadius >= math.Pi/2 || ratio >= 1 {
+		return box
+	}
+
+	dLon := math.Asin(ratio) * 180 / math.Pi
+	box.MinLon, box.MaxLon = normalizeLon(center.Lon-dLon), normalizeLon(center.Lon+dLon)
+	return box
+}
+
+func normalizeLon(lon float64) float64 {
+	for lon < -180 {
+		lon += 360
+	}
+	for lon > 180 {
+		lon -= 360
+	}
+	return lon
+}
+
+type gridCell struct {
+	lat, lon int
+}
+
+func cellOf(c Coordinate) gridCell {
+	return gridCell{int(math.Floor(c.Lat / gridCellSize)), int(math.Floor(c.Lon / gridCellSize))}
+}
+
+// A spatialIndex finds the webcams in a bounding box by grouping them in cells
+// of a grid, so that only the webcams of the cells overlapping the box are checked.
+type spatialIndex struct {
+	webcams []Webcam
+	cells   map[gridCell][]int
+}
+
+func newSpatialIndex(webcams []Webcam) *spatialIndex {
+	index := &spatialIndex{webcams, make(map[gridCell][]int)}
+	for i, w := range webcams {
+		cell := cellOf(w.Position)
+		index.cells[cell] = append(index.cells[cell], i)
+	}
+	return index
+}
+
+// inBox returns the indices of the webcams in a bounding box, in increasing order.
+func (s *spatialIndex) inBox(box boundingBox) []int {
+	if box.MinLon > box.MaxLon {
+		// Split boxes crossing the antimeridian
+		result := append(s.inBox(boundingBox{box.MinLon, box.MinLat, 180, box.MaxLat}), s.inBox(boundingBox{-180, box.MinLat, box.MaxLon, box.MaxLat})...)
+		sort.Ints(result)
+		return result
+	}
+
+	min, max := cellOf(Coordinate{box.MinLat, box.MinLon}), cellOf(Coordinate{box.MaxLat, box.MaxLon})
+
+	result := []int{}
+	addCell := func(indices []int) {
+		for _, i := range indices {
+			if box.contains(s.webcams[i].Position) {
+				result = append(result, i)
+			}
+		}
+	}
+
+	// Iterate over the occupied cells if the box covers more cells than there are
+	if (max.lat-min.lat+1)*(max.lon-min.lon+1) > len(s.cells) {
+		for cell, indices := range s.cells {
+			if cell.lat >= min.lat && cell.lat <= max.lat && cell.lon >= min.lon && cell.lon <= max.lon {
+				addCell(indices)
+			}
+		}
+	} else {
+		for lat := min.lat; lat <= max.lat; lat++ {
+			for lon := min.lon; lon <= max.lon; lon++ {
+				addCell(s.cells[gridCell{lat, lon}])
+			}
+		}
+	}
+
+	sort.Ints(result)
+	return result
+}
+
+// A geoQuery filters webcams by position. Webcams are sorted by distance to
+// near, if set, and limited to the radius around it and to the bounding box.
+type geoQuery struct {
+	near   *Coordinate
+	radius float64
+	bbox   *boundingBox
+}
+
+// parseGeoQuery reads the near, radius and bbox parameters, returning nil if none is set.
+func parseGeoQuery(query url.Values) (*geoQuery, error) {
+	near, radius, bbox := query.Get("near"), query.Get("radius"), query.Get("bbox")
+	if near == "" && bbox == "" {
+		if radius != "" {
+			return nil, StatusError{http.StatusBadRequest, errors.New("radius requires near")}
+		}
+		return nil, nil
+	}
+
+	q := &geoQuery{}
+
+	if near != "" {
+		values, err := parseFloats(near, 2)
+		if err != nil || math.Abs(values[0]) > 90 || math.Abs(values[1]) > 180 {
+			return nil, StatusError{http.StatusBadRequest, errors.New("near must be lat,lon, got " + near)}
+		}
+		q.near = &Coordinate{values[0], values[1]}
+	}
+
+	if radius != "" {
+		if q.near == nil {
+			return nil, StatusError{http.StatusBadRequest, errors.New("radius requires near")}
+		}
+
+		r, err := strconv.ParseFloat(radius, 64)
+		if err != nil || r <= 0 || math.IsInf(r, 0) || math.IsNaN(r) {
+			return nil, StatusError{http.StatusBadRequest, errors.New("radius must be a positive number of kilometers, got " + radius)}
+		}
+		q.radius = r
+	}
+
+	if bbox != "" {
+		values, err := parseFloats(bbox, 4)
+		if err != nil || math.Abs(values[0]) > 180 || math.Abs(values[2]) > 180 || values[1] < -90 || values[3] > 90 || values[1] > values[3] {
+			return nil, StatusError{http.StatusBadRequest, errors.New("bbox must be minLon,minLat,maxLon,maxLat, got " + bbox)}
+		}
+		q.bbox = &boundingBox{values[0], values[1], values[2], values[3]}
+	}
+
+	return q, nil
+}
+
+// parseFloats parses n comma-separated numbers.
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, errors.New("Expected " + strconv.Itoa(n) + " numbers")
+	}
+
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, errors.New("Invalid number " + part)
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// A geoResult is a webcam matching a geoQuery.
+type geoResult struct {
+	index    int
+	distance float64
+}
+
+// apply returns the webcams of the index matching the query, sorted by
+// distance if near is set or by their order in the index otherwise.
+func (q *geoQuery) apply(s *spatialIndex) []geoResult {
+	var candidates []int
+	switch {
+	case q.bbox != nil:
+		candidates = s.inBox(*q.bbox)
+	case q.radius > 0:
+		candidates = s.inBox(circleBox(*q.near, q.radius))
+	default:
+		candidates = make([]int, len(s.webcams))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
+
+	results := make([]geoResult, 0, len(candidates))
+	for _, i := range candidates {
+		r := geoResult{index: i}
+		if q.near != nil {
+			r.distance = distance(*q.near, s.webcams[i].Position)
+			if q.radius > 0 && r.distance > q.radius {
+				continue
+			}
+		}
+		results = append(results, r)
+	}
+
+	if q.near != nil {
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].distance < results[j].distance
+		})
+	}
+
+	return results
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     Coordinate
+		expected float64
+	}{
+		{Coordinate{46.5197, 6.6323}, Coordinate{46.5197, 6.6323}, 0},
+		// Lausanne to Zurich
+		{Coordinate{46.5197, 6.6323}, Coordinate{47.3769, 8.5417}, 173.5},
+		// Across the antimeridian
+		{Coordinate{0, 179.5}, Coordinate{0, -179.5}, 111.2},
+		{Coordinate{90, 0}, Coordinate{-90, 0}, math.Pi * earthRadius},
+	}
+
+	for _, test := range tests {
+		if d := distance(test.a, test.b); math.Abs(d-test.expected) > 0.1 {
+			t.Errorf("Distance between %v and %v: expected %f, got %f\n", test.a, test.b, test.expected, d)
+		}
+	}
+}
+
+func TestSpatialIndex(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	webcams := make([]Webcam, 2000)
+	for i := range webcams {
+		webcams[i] = Webcam{ID: i, Position: Coordinate{random.Float64()*180 - 90, random.Float64()*360 - 180}}
+	}
+	index := newSpatialIndex(webcams)
+
+	queries := []geoQuery{
+		geoQuery{near: &Coordinate{46.5, 6.6}, radius: 500},
+		geoQuery{near: &Coordinate{0, 179.9}, radius: 1000},
+		geoQuery{near: &Coordinate{-89, 0}, radius: 400},
+		geoQuery{near: &Coordinate{10, 10}, radius: 30000},
+		geoQuery{bbox: &boundingBox{5, 45, 11, 48}},
+		geoQuery{bbox: &boundingBox{170, -10, -170, 10}},
+		geoQuery{near: &Coordinate{0, 0}, bbox: &boundingBox{-30, -30, 30, 30}},
+	}
+
+	for _, q := range queries {
+		// Compare with a scan of all webcams
+		expected := 0
+		for _, w := range webcams {
+			if (q.bbox == nil || q.bbox.contains(w.Position)) && (q.radius == 0 || distance(*q.near, w.Position) <= q.radius) {
+				expected++
+			}
+		}
+
+		results := q.apply(index)
+		if len(results) != expected || expected == 0 {
+			t.Errorf("%v %v: expected %d webcams, got %d\n", q.near, q.bbox, expected, len(results))
+		}
+
+		for i := 1; q.near != nil && i < len(results); i++ {
+			if results[i].distance < results[i-1].distance {
+				t.Errorf("%v: results are not sorted by distance\n", q.near)
+				break
+			}
+		}
+	}
+}
+
+func TestWebcamListGeoQuery(t *testing.T) {
+	controller := &WebcamController{}
+	controller.SetWebcams([]Webcam{
+		Webcam{ID: 1, Name: "Zurich", Position: Coordinate{47.3769, 8.5417}},
+		Webcam{ID: 2, Name: "Lausanne", Position: Coordinate{46.5197, 6.6323}},
+		Webcam{ID: 3, Name: "Bern", Position: Coordinate{46.9480, 7.4474}},
+		Webcam{ID: 4, Name: "Private", Position: Coordinate{46.9481, 7.4475}, Private: true},
+		Webcam{ID: 5, Name: "Tokyo", Position: Coordinate{35.6762, 139.6503}},
+	})
+
+	router := NewRouter(nil)
+	router.Mount("/webcam", controller)
+
+	tests := []struct {
+		query    string
+		code     int
+		expected []int
+	}{
+		{"", 200, []int{1, 2, 3, 5}},
+		{"?near=46.5,6.6", 200, []int{2, 3, 1, 5}},
+		{"?near=46.5,6.6&radius=100", 200, []int{2, 3}},
+		{"?bbox=7,46,9,48", 200, []int{1, 3}},
+		{"?bbox=7,46,9,48&near=47.4,8.5", 200, []int{1, 3}},
+		{"?bbox=7,46,9,48&near=46.9,7.4", 200, []int{3, 1}},
+		{"?near=46.5", 400, nil},
+		{"?near=46.5,abc", 400, nil},
+		{"?near=95,6", 400, nil},
+		{"?near=46.5,6.6&radius=-1", 400, nil},
+		{"?radius=10", 400, nil},
+		{"?bbox=7,48,9,46", 400, nil},
+		{"?bbox=7,46,9", 400, nil},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/webcam"+test.query, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != test.code {
+			t.Errorf("%s: expected %d, got %d\n", test.query, test.code, rec.Code)
+			continue
+		}
+		if test.code != 200 {
+			continue
+		}
+
+		entries := []webcamListEntry{}
+		json.Unmarshal(rec.Body.Bytes(), &entries)
+
+		ids := []int{}
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+
+		if len(ids) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v\n", test.query, test.expected, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != test.expected[i] {
+				t.Errorf("%s: expected %v, got %v\n", test.query, test.expected, ids)
+				break
+			}
+		}
+	}
+}
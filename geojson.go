@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Health statuses of webcams, derived from their latest stored frame.
+const (
+	// healthOK means that the latest frame is recent.
+	healthOK = "ok"
+	// healthStale means that several scheduled fetches stored no frame.
+	healthStale = "stale"
+	// healthNoData means that no frame is stored.
+	healthNoData = "no-data"
+	// healthPaused means that crawling is paused at night.
+	healthPaused = "paused"
+)
+
+// Number of scheduled fetches without new frame after which a webcam is stale.
+const staleIntervals = 3
+
+// A GeoJSONController serves the catalogue of webcams as GeoJSON, to display them on maps.
+type GeoJSONController struct {
+	webcams *WebcamController
+}
+
+// GetRoutes returns the routes handled by this controller.
+func (c *GeoJSONController) GetRoutes() []Route {
+	return []Route{
+		Route{Method: "GET", Path: "/webcam.geojson", Handler: c.sendGeoJSON, Name: "webcams.geojson", Doc: &RouteDoc{
+			Summary:     "Get the webcams as a GeoJSON FeatureCollection of points",
+			ContentType: "application/geo+json",
+			Schema:      Schema{"type": "object"},
+		}},
+	}
+}
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string           `json:"type"`
+	ID         int              `json:"id"`
+	Geometry   geoJSONPoint     `json:"geometry"`
+	Properties webcamProperties `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type string `json:"type"`
+	// Coordinates are the longitude and latitude, in this order.
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type webcamProperties struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	LatestFrame string     `json:"latestFrame,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	Health      string     `json:"health"`
+}
+
+func (c *GeoJSONController) sendGeoJSON(w http.ResponseWriter, r *http.Request, p PathParams) error {
+	w.Header().Set("Content-Type", "application/geo+json")
+	return json.NewEncoder(w).Encode(c.webcams.geoJSON(GrantFromRequest(r), time.Now()))
+}
+
+// geoJSON returns the webcams visible with the grant as a FeatureCollection.
+// Links to the latest frames are only set if the controller has a URL builder.
+func (c *WebcamController) geoJSON(grant *Grant, now time.Time) geoJSONCollection {
+	collection := geoJSONCollection{"FeatureCollection", []geoJSONFeature{}}
+
+	for i := range c.webcams {
+		webcam := &c.webcams[i]
+		if !grant.CanSee(webcam) {
+			continue
+		}
+
+		properties := webcamProperties{ID: webcam.ID, Name: webcam.Name, Health: healthNoData}
+
+		id := strconv.Itoa(webcam.ID)
+		if frames, err := c.storedFrames(id); err == nil && len(frames) > 0 {
+			latest := frames[len(frames)-1]
+			properties.LastSuccess = &latest.Time
+			properties.Health = webcamHealth(webcam, latest.Time, now)
+
+			if c.urls != nil {
+				properties.LatestFrame, _ = c.urls.URL("webcam.frame", PathParams{"id": id, "name": latest.Name})
+			}
+		}
+
+		collection.Features = append(collection.Features, geoJSONFeature{
+			"Feature",
+			webcam.ID,
+			geoJSONPoint{"Point", [2]float64{webcam.Position.Lon, webcam.Position.Lat}},
+			properties,
+		})
+	}
+
+	return collection
+}
+
+// webcamHealth returns the health of a webcam whose latest frame was taken at the given time.
+func webcamHealth(webcam *Webcam, latest time.Time, now time.Time) string {
+	if webcam.Daylight != nil && webcam.Daylight.isPaused(webcam.Position, now) {
+		return healthPaused
+	}
+
+	schedule, err := webcam.schedule()
+	if err != nil || schedule == nil {
+		return healthOK
+	}
+
+	// Stale if the fetches scheduled after the latest frame were all missed
+	next := latest
+	for i := 0; i < staleIntervals; i++ {
+		if next = schedule.Next(next); next.IsZero() || next.After(now) {
+			return healthOK
+		}
+	}
+
+	return healthStale
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGeoJSON(t *testing.T) {
+	storagePath, err := ioutil.TempDir("", "hist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(storagePath)
+
+	os.MkdirAll(filepath.Join(storagePath, "1"), os.ModePerm)
+	os.MkdirAll(filepath.Join(storagePath, "2"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(storagePath, "1", "2026-10-17T07:50:00Z.png"), imageData, 0644)
+	ioutil.WriteFile(filepath.Join(storagePath, "1", "2026-10-17T08:00:00Z.png"), imageData, 0644)
+	ioutil.WriteFile(filepath.Join(storagePath, "2", "2026-10-17T06:00:00Z.png"), imageData, 0644)
+
+	controller := &WebcamController{storagePath: storagePath}
+	controller.SetWebcams([]Webcam{
+		Webcam{ID: 1, Name: "Recent", Position: Coordinate{46.5, 6.9}, CrawlIntervalString: "10m"},
+		Webcam{ID: 2, Name: "Stale", Position: Coordinate{46.0, 7.1}, CrawlIntervalString: "10m"},
+		Webcam{ID: 3, Name: "Empty", Position: Coordinate{47.0, 8.0}, CrawlIntervalString: "10m"},
+		Webcam{ID: 4, Name: "Private", Private: true},
+	})
+
+	router := NewRouter(nil)
+	router.Mount("/webcam", controller)
+	router.Mount("", &GeoJSONController{controller})
+	controller.SetURLBuilder(router)
+
+	// Check the health at a fixed time
+	collection := controller.geoJSON(nil, time.Date(2026, 10, 17, 8, 15, 0, 0, time.UTC))
+
+	expected := []struct {
+		id     int
+		frame  string
+		health string
+	}{
+		{1, "/webcam/1/hist/2026-10-17T08:00:00Z.png", healthOK},
+		{2, "/webcam/2/hist/2026-10-17T06:00:00Z.png", healthStale},
+		{3, "", healthNoData},
+	}
+
+	if len(collection.Features) != len(expected) {
+		t.Fatalf("Expected %d features, got %d\n", len(expected), len(collection.Features))
+	}
+
+	for i, e := range expected {
+		p := collection.Features[i].Properties
+		if p.ID != e.id || p.LatestFrame != e.frame || p.Health != e.health || (p.LastSuccess == nil) != (e.frame == "") {
+			t.Errorf("Expected webcam %d with frame %q and health %s, got %+v\n", e.id, e.frame, e.health, p)
+		}
+	}
+
+	// The feature collection is served with coordinates in longitude, latitude order
+	req := httptest.NewRequest("GET", "/webcam.geojson", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	served := struct {
+		Type     string
+		Features []struct {
+			Type     string
+			Geometry struct {
+				Type        string
+				Coordinates []float64
+			}
+		}
+	}{}
+	json.Unmarshal(rec.Body.Bytes(), &served)
+
+	if rec.Header().Get("Content-Type") != "application/geo+json" || served.Type != "FeatureCollection" || len(served.Features) != 3 {
+		t.Fatalf("Unexpected response %s\n", rec.Body.String())
+	}
+
+	g := served.Features[0].Geometry
+	if served.Features[0].Type != "Feature" || g.Type != "Point" || len(g.Coordinates) != 2 || g.Coordinates[0] != 6.9 || g.Coordinates[1] != 46.5 {
+		t.Errorf("Unexpected feature %+v\n", served.Features[0])
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A Group registers routes under a common path prefix. The middleware of a
+// group wrap its routes, inside the middleware of its parent groups, and its
+// default handler serves the requests under its prefix that match no route.
+type Group struct {
+	router         *Router
+	parent         *Group
+	prefix         string
+	middleware     []Middleware
+	defaultHandler Handler
+}
+
+// Group creates a group of routes under a path prefix.
+func (r *Router) Group(prefix string, middleware ...Middleware) *Group {
+	g := &Group{
+		router:     r,
+		prefix:     strings.TrimSuffix(prefix, "/"),
+		middleware: middleware,
+	}
+
+	r.groups = append(r.groups, g)
+	return g
+}
+
+// Group creates a nested group, whose prefix is relative to the prefix of g.
+func (g *Group) Group(prefix string, middleware ...Middleware) *Group {
+	sub := g.router.Group(g.prefix+prefix, middleware...)
+	sub.parent = g
+	return sub
+}
+
+// Use adds middleware wrapping every route of the group and of its nested groups.
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// SetDefaultHandler sets the handler of requests under the prefix of the group
+// that match no route.
+func (g *Group) SetDefaultHandler(handler Handler) {
+	g.defaultHandler = handler
+}
+
+// Mount a controller on a path relative to the prefix of the group.
+func (g *Group) Mount(path string, controller Controller, middleware ...Middleware) error {
+	return g.router.addRoutes(g.prefix+path, controller.GetRoutes(), middleware, g)
+}
+
+// wrap wraps a handler with the middleware of the group and of its parents. Middleware
+// are looked up on each request so that middleware added later also apply.
+func (g *Group) wrap(handler Handler) Handler {
+	return func(w http.ResponseWriter, req *http.Request, p PathParams) error {
+		h := handler
+		for group := g; group != nil; group = group.parent {
+			h = chain(h, group.middleware)
+		}
+
+		return h(w, req, p)
+	}
+}
+
+// contains tells whether a path is under the prefix of the group.
+func (g *Group) contains(path string) bool {
+	prefix := splitPath(g.prefix)
+	segments := splitPath(path)
+
+	if len(segments) < len(prefix) {
+		return false
+	}
+
+	for i, s := range prefix {
+		if segments[i] != s {
+			return false
+		}
+	}
+
+	return true
+}
+
+// A URLBuilder builds the URL of named routes.
+type URLBuilder interface {
+	URL(name string, params PathParams) (string, error)
+}
+
+// URL returns the path of the route with the given name, filled with params.
+// Parameter values are escaped and must satisfy the constraints of the route.
+func (r *Router) URL(name string, params PathParams) (string, error) {
+	pattern, ok := r.names[name]
+	if !ok {
+		return "", errors.New("No route named " + name)
+	}
+
+	segments := make([]string, 0)
+	for _, s := range splitPath(pattern) {
+		n, err := parseSegment(s)
+		if err != nil {
+			return "", err
+		}
+
+		if n.kind == literalNode {
+			segments = append(segments, s)
+			continue
+		}
+
+		value, ok := params[n.value]
+		if !ok || value == "" {
+			return "", errors.New("Missing parameter " + n.value + " for route " + name)
+		}
+
+		if n.kind == catchAllNode {
+			for _, v := range splitPath(value) {
+				segments = append(segments, url.PathEscape(v))
+			}
+			continue
+		}
+
+		if n.kind == constrainedParamNode && !n.matches(value) {
+			return "", errors.New("Parameter " + n.value + " does not satisfy the constraint " + n.pattern + " of route " + name)
+		}
+
+		segments = append(segments, url.PathEscape(value))
+	}
+
+	return "/" + strings.Join(segments, "/"), nil
+}
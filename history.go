@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A storedFrame is an image saved by the crawler.
+type storedFrame struct {
+	Name string
+	Time time.Time
+	Size int64
+}
+
+// before orders frames by time, then by name for frames taken at the same time.
+func (f storedFrame) before(o storedFrame) bool {
+	if f.Time.Equal(o.Time) {
+		return f.Name < o.Name
+	}
+	return f.Time.Before(o.Time)
+}
+
+// Ways of selecting a frame relative to a point in time.
+const (
+	matchNearest = "nearest"
+	matchBefore  = "before"
+	matchAfter   = "after"
+)
+
+// findFrame returns the frame matching t in the given mode, among frames sorted
+// oldest first. A positive tolerance limits how far from t the frame can be.
+func findFrame(frames []storedFrame, t time.Time, mode string, tolerance time.Duration) (storedFrame, bool) {
+	// Index of the first frame at or after t
+	i := sort.Search(len(frames), func(i int) bool {
+		return !frames[i].Time.Before(t)
+	})
+
+	candidates := make([]storedFrame, 0, 2)
+	if i > 0 && mode != matchAfter {
+		candidates = append(candidates, frames[i-1])
+	}
+	if i < len(frames) && mode != matchBefore {
+		candidates = append(candidates, frames[i])
+	}
+	if i < len(frames) && mode == matchBefore && frames[i].Time.Equal(t) {
+		candidates = []storedFrame{frames[i]}
+	}
+
+	var best storedFrame
+	found := false
+	for _, f := range candidates {
+		if !found || absDuration(f.Time.Sub(t)) < absDuration(best.Time.Sub(t)) {
+			best = f
+			found = true
+		}
+	}
+
+	if found && tolerance > 0 && absDuration(best.Time.Sub(t)) > tolerance {
+		return storedFrame{}, false
+	}
+
+	return best, found
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// Precision of the modification times of folders. A file added shortly after
+// a scan can leave the modification time of its folder unchanged.
+const modTimePrecision = 2 * time.Second
+
+// A historyIndex keeps the sorted list of frames stored in each webcam folder,
+// so that the folders are only scanned again when their content changes.
+// Its zero value is ready to use.
+type historyIndex struct {
+	mu   sync.Mutex
+	dirs map[string]*indexedDir
+}
+
+type indexedDir struct {
+	modTime time.Time
+	// scanned is the time at which the folder was scanned.
+	scanned time.Time
+	frames  []storedFrame
+}
+
+// frames returns the frames stored in dirname, oldest first. The returned
+// slice is shared and must not be modified.
+func (h *historyIndex) frames(dirname string, format string) ([]storedFrame, error) {
+	now := time.Now()
+	info, err := os.Stat(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.dirs == nil {
+		h.dirs = make(map[string]*indexedDir)
+	}
+
+	// The folder is scanned again while it was last scanned within the precision
+	// of its modification time, which may not reflect the files added since
+	dir, ok := h.dirs[dirname]
+	if ok && dir.modTime.Equal(info.ModTime()) && dir.scanned.Sub(dir.modTime) > modTimePrecision {
+		return dir.frames, nil
+	}
+
+	var previous []storedFrame
+	if ok {
+		previous = dir.frames
+	}
+
+	frames, err := scanFrames(dirname, format, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	h.dirs[dirname] = &indexedDir{info.ModTime(), now, frames}
+	return frames, nil
+}
+
+// scanFrames lists the frames in dirname. Only files that are not part of
+// the previous scan are examined.
+func scanFrames(dirname string, format string, previous []storedFrame) ([]storedFrame, error) {
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]storedFrame, len(previous))
+	for _, f := range previous {
+		known[f.Name] = f
+	}
+
+	frames := make([]storedFrame, 0, len(names))
+	for _, name := range names {
+		if f, ok := known[name]; ok {
+			frames = append(frames, f)
+			continue
+		}
+
+		t, err := frameTime(name, format)
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Lstat(filepath.Join(dirname, name))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		frames = append(frames, storedFrame{name, t, info.Size()})
+	}
+
+	sort.Slice(frames, func(i, j int) bool {
+		return frames[i].before(frames[j])
+	})
+
+	return frames, nil
+}
+
+const (
+	// Default and maximum number of frames in a page of history.
+	defaultHistoryLimit = 1000
+	maxHistoryLimit     = 10000
+)
+
+// A historyQuery selects a page of frames in a history.
+type historyQuery struct {
+	from       time.Time
+	to         time.Time
+	limit      int
+	descending bool
+	cursor     *storedFrame
+}
+
+// parseHistoryQuery reads the from, to, limit, cursor and order query parameters.
+func parseHistoryQuery(query url.Values, format string) (historyQuery, error) {
+	q := historyQuery{limit: defaultHistoryLimit}
+
+	var err error
+	if s := query.Get("from"); s != "" {
+		if q.from, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, StatusError{http.StatusBadRequest, errors.New("Invalid from time " + s)}
+		}
+	}
+
+	if s := query.Get("to"); s != "" {
+		if q.to, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, StatusError{http.StatusBadRequest, errors.New("Invalid to time " + s)}
+		}
+	}
+
+	if s := query.Get("limit"); s != "" {
+		if q.limit, err = strconv.Atoi(s); err != nil || q.limit < 1 || q.limit > maxHistoryLimit {
+			return q, StatusError{http.StatusBadRequest, errors.New("Invalid limit " + s)}
+		}
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.descending = true
+	default:
+		return q, StatusError{http.StatusBadRequest, errors.New("Unknown order " + query.Get("order"))}
+	}
+
+	if s := query.Get("cursor"); s != "" {
+		name, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return q, StatusError{http.StatusBadRequest, errors.New("Invalid cursor")}
+		}
+
+		t, err := frameTime(string(name), format)
+		if err != nil {
+			return q, StatusError{http.StatusBadRequest, errors.New("Invalid cursor")}
+		}
+
+		q.cursor = &storedFrame{Name: string(name), Time: t}
+	}
+
+	return q, nil
+}
+
+// apply returns the selected frames, in the requested order, and the cursor
+// of the next page, which is empty on the last page.
+func (q historyQuery) apply(frames []storedFrame) ([]storedFrame, string) {
+	// Restrict frames to the [from, to] range
+	start := 0
+	if !q.from.IsZero() {
+		start = sort.Search(len(frames), func(i int) bool {
+			return !frames[i].Time.Before(q.from)
+		})
+	}
+
+	end := len(frames)
+	if !q.to.IsZero() {
+		end = sort.Search(len(frames), func(i int) bool {
+			return frames[i].Time.After(q.to)
+		})
+	}
+
+	if end < start {
+		end = start
+	}
+
+	// Continue after the cursor
+	if q.cursor != nil {
+		c := *q.cursor
+		if q.descending {
+			end = start + sort.Search(end-start, func(i int) bool {
+				return !frames[start+i].before(c)
+			})
+		} else {
+			start = start + sort.Search(end-start, func(i int) bool {
+				return c.before(frames[start+i])
+			})
+		}
+	}
+
+	count := end - start
+	if count > q.limit {
+		count = q.limit
+	}
+
+	page := make([]storedFrame, count)
+	if q.descending {
+		for i := range page {
+			page[i] = frames[end-1-i]
+		}
+	} else {
+		copy(page, frames[start:start+count])
+	}
+
+	next := ""
+	if count > 0 && count < end-start {
+		next = base64.RawURLEncoding.EncodeToString([]byte(page[count-1].Name))
+	}
+
+	return page, next
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createFrames creates files with the given names in a temporary directory.
+func createFrames(t *testing.T, names []string) string {
+	dirname, err := ioutil.TempDir("", "hist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		ioutil.WriteFile(filepath.Join(dirname, name), []byte(name), 0644)
+	}
+
+	return dirname
+}
+
+func TestFindFrame(t *testing.T) {
+	dirname := createFrames(t, []string{
+		"2026-10-17T08:10:00Z.jpg",
+		"2026-10-17T08:00:00Z.jpg",
+		"invalid.jpg",
+		"2026-10-17T08:04:00Z.png",
+	})
+	defer os.RemoveAll(dirname)
+
+	index := historyIndex{}
+	frames, _ := index.frames(dirname, time.RFC3339)
+
+	if len(frames) != 3 {
+		t.Fatalf("Expected 3 frames, got %d\n", len(frames))
+	}
+
+	at := func(s string) time.Time {
+		v, _ := time.Parse(time.RFC3339, s)
+		return v
+	}
+
+	tests := []struct {
+		t         string
+		mode      string
+		tolerance time.Duration
+		expected  string
+	}{
+		{"2026-10-17T08:03:00Z", matchNearest, 0, "2026-10-17T08:04:00Z.png"},
+		{"2026-10-17T08:03:00Z", matchBefore, 0, "2026-10-17T08:00:00Z.jpg"},
+		{"2026-10-17T08:03:00Z", matchAfter, 0, "2026-10-17T08:04:00Z.png"},
+		{"2026-10-17T08:04:00Z", matchBefore, 0, "2026-10-17T08:04:00Z.png"},
+		{"2026-10-17T07:00:00Z", matchNearest, 0, "2026-10-17T08:00:00Z.jpg"},
+		{"2026-10-17T07:00:00Z", matchBefore, 0, ""},
+		{"2026-10-17T09:00:00Z", matchAfter, 0, ""},
+		{"2026-10-17T09:00:00Z", matchNearest, 10 * time.Minute, ""},
+		{"2026-10-17T08:15:00Z", matchNearest, 10 * time.Minute, "2026-10-17T08:10:00Z.jpg"},
+	}
+
+	for _, test := range tests {
+		frame, ok := findFrame(frames, at(test.t), test.mode, test.tolerance)
+		if test.expected == "" && ok {
+			t.Errorf("%s %s: expected no frame, got %s\n", test.mode, test.t, frame.Name)
+		}
+		if test.expected != "" && frame.Name != test.expected {
+			t.Errorf("%s %s: expected %s, got %s\n", test.mode, test.t, test.expected, frame.Name)
+		}
+	}
+}
+
+func TestHistoryIndexRescan(t *testing.T) {
+	dirname := createFrames(t, []string{"2026-10-17T08:00:00Z.jpg"})
+	defer os.RemoveAll(dirname)
+
+	index := historyIndex{}
+	if frames, _ := index.frames(dirname, time.RFC3339); len(frames) != 1 {
+		t.Fatalf("Expected 1 frame, got %d\n", len(frames))
+	}
+
+	os.Mkdir(filepath.Join(dirname, thumbnailDir), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dirname, "2026-10-17T07:00:00Z.jpg"), []byte("hello"), 0644)
+
+	frames, _ := index.frames(dirname, time.RFC3339)
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 frames, got %d\n", len(frames))
+	}
+
+	if frames[0].Name != "2026-10-17T07:00:00Z.jpg" || frames[0].Size != 5 {
+		t.Errorf("Unexpected first frame %+v\n", frames[0])
+	}
+
+	// A file added without changing the modification time of the folder is found
+	// until a scan happens well after that modification time
+	info, _ := os.Stat(dirname)
+	ioutil.WriteFile(filepath.Join(dirname, "2026-10-17T09:00:00Z.jpg"), []byte("hello"), 0644)
+	os.Chtimes(dirname, info.ModTime(), info.ModTime())
+
+	if frames, _ := index.frames(dirname, time.RFC3339); len(frames) != 3 {
+		t.Errorf("Expected 3 frames, got %d\n", len(frames))
+	}
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(dirname, old, old)
+	index.frames(dirname, time.RFC3339)
+	os.Remove(filepath.Join(dirname, "2026-10-17T09:00:00Z.jpg"))
+	os.Chtimes(dirname, old, old)
+
+	if frames, _ := index.frames(dirname, time.RFC3339); len(frames) != 3 {
+		t.Errorf("Expected the indexed frames of an unchanged folder, got %d\n", len(frames))
+	}
+}
+
+func TestHistoryQueryPagination(t *testing.T) {
+	dirname := createFrames(t, []string{
+		"2026-10-17T08:00:00Z.jpg",
+		"2026-10-17T08:01:00Z.jpg",
+		"2026-10-17T08:02:00Z.jpg",
+		"2026-10-17T08:03:00Z.jpg",
+		"2026-10-17T08:04:00Z.jpg",
+	})
+	defer os.RemoveAll(dirname)
+
+	index := historyIndex{}
+	frames, _ := index.frames(dirname, time.RFC3339)
+
+	tests := []struct {
+		query    string
+		expected [][]string
+	}{
+		{"", [][]string{{"08:00", "08:01", "08:02", "08:03", "08:04"}}},
+		{"limit=2", [][]string{{"08:00", "08:01"}, {"08:02", "08:03"}, {"08:04"}}},
+		{"limit=2&order=desc", [][]string{{"08:04", "08:03"}, {"08:02", "08:01"}, {"08:00"}}},
+		{"from=2026-10-17T08:01:00Z&to=2026-10-17T08:03:00Z&limit=2", [][]string{{"08:01", "08:02"}, {"08:03"}}},
+		{"from=2026-10-17T08:01:00Z&to=2026-10-17T08:03:00Z&limit=2&order=desc", [][]string{{"08:03", "08:02"}, {"08:01"}}},
+		{"from=2026-10-17T09:00:00Z", [][]string{{}}},
+	}
+
+	for _, test := range tests {
+		values, _ := url.ParseQuery(test.query)
+
+		for i, expected := range test.expected {
+			query, err := parseHistoryQuery(values, time.RFC3339)
+			if err != nil {
+				t.Fatalf("%s: %s\n", test.query, err)
+			}
+
+			page, next := query.apply(frames)
+			if len(page) != len(expected) {
+				t.Fatalf("%s page %d: expected %d frames, got %d\n", test.query, i, len(expected), len(page))
+			}
+
+			for j, f := range page {
+				if f.Time.Format("15:04") != expected[j] {
+					t.Errorf("%s page %d: expected %s, got %s\n", test.query, i, expected[j], f.Name)
+				}
+			}
+
+			if (next == "") != (i == len(test.expected)-1) {
+				t.Errorf("%s page %d: unexpected cursor %q\n", test.query, i, next)
+			}
+
+			values.Set("cursor", next)
+		}
+	}
+
+	if _, err := parseHistoryQuery(url.Values{"limit": {"0"}}, time.RFC3339); err == nil {
+		t.Errorf("Expected an error for an invalid limit\n")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	// Register decoders for the formats delivered by webcams.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Maximum number of pixels of the images that are decoded, so that images
+// declaring huge dimensions cannot make the decoder allocate gigabytes.
+const maxDecodePixels = 50000000
+
+// decodeImage decodes an image after checking that its dimensions are not too large.
+func decodeImage(data []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if int64(config.Width)*int64(config.Height) > maxDecodePixels {
+		return nil, "", fmt.Errorf("Image of %dx%d pixels exceeds the maximum of %d pixels", config.Width, config.Height, maxDecodePixels)
+	}
+
+	return image.Decode(bytes.NewReader(data))
+}
+
+// toRGBA converts any image to an *image.RGBA whose bounds start at the origin.
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	if rgba, ok := src.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// resizeImage scales src to exactly width x height pixels. Each destination
+// pixel is the average of the source pixels it covers, which gives smooth
+// results when downscaling.
+func resizeImage(src image.Image, width, height int) *image.RGBA {
+	s := toRGBA(src)
+	sw, sh := s.Bounds().Dx(), s.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	if sw == 0 || sh == 0 || width <= 0 || height <= 0 {
+		return dst
+	}
+
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := (y + 1) * sh / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := (x + 1) * sw / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := s.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(s.Pix[i])
+					g += uint32(s.Pix[i+1])
+					b += uint32(s.Pix[i+2])
+					a += uint32(s.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// fitSize returns the largest size with the aspect ratio of width x height
+// that fits in maxWidth x maxHeight. Images are never scaled up.
+func fitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+
+	w, h := maxWidth, height*maxWidth/width
+	if h > maxHeight {
+		w, h = width*maxHeight/height, maxHeight
+	}
+
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	return w, h
+}
+
+// quantizeImage converts src to a paletted image suitable for GIF encoding,
+// using Floyd-Steinberg dithering over the Plan 9 palette.
+func quantizeImage(src image.Image) *image.Paletted {
+	b := src.Bounds()
+	dst := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette.Plan9)
+	draw.FloydSteinberg.Draw(dst, dst.Bounds(), src, b.Min)
+	return dst
+}
+
+// cropToAspect returns the largest centered region of src with the aspect
+// ratio width:height.
+func cropToAspect(src image.Image, width, height int) image.Image {
+	b := src.Bounds()
+	cw, ch := b.Dx(), b.Dy()
+
+	if cw*height > ch*width {
+		cw = ch * width / height
+	} else {
+		ch = cw * height / width
+	}
+
+	x0 := b.Min.X + (b.Dx()-cw)/2
+	y0 := b.Min.Y + (b.Dy()-ch)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, cw, ch))
+	draw.Draw(dst, dst.Bounds(), src, image.Pt(x0, y0), draw.Src)
+	return dst
+}
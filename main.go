@@ -3,8 +3,14 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func loadWebcams() []Webcam {
@@ -22,31 +28,144 @@ func loadWebcams() []Webcam {
 	return webcams
 }
 
-func startCrawler(webcams []Webcam) {
+func startCrawler(webcams []Webcam, client *http.Client) {
 	crawler := NewCralwer(webcams, "hist")
+	crawler.client = client
 	crawler.Start()
 }
 
-func startWebServer(webcams []Webcam) {
+func startWebServer(webcams []Webcam, config Config, client *http.Client) {
 	controller := &WebcamController{
+		client:      *client,
 		storagePath: "hist",
 	}
 	controller.SetWebcams(webcams)
 
+	limiter, err := NewRateLimiter(config.RateLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authenticator := NewAuthenticator(config.Auth)
+	authenticator.AllowAnonymous("ui", "ui.file")
+
 	router := NewRouter(defaultHandler)
-	router.Mount("/webcam", controller)
+	router.Use(authenticator.Middleware, limiter.Middleware)
+	router.SetCORS(config.CORS)
+	controller.SetURLBuilder(router)
+	if err := router.Mount("/webcam", controller); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := router.Mount("", &GeoJSONController{controller}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := router.Mount("", &UIController{}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := router.ServeOpenAPI("/openapi.json", "Webcam crawler", "1.0"); err != nil {
+		log.Fatal(err)
+	}
 
-	http.Handle("/", router)
-	http.ListenAndServe(":8080", nil)
+	log.Fatal(serve(config.Server, router))
 }
 
 func defaultHandler(w http.ResponseWriter, r *http.Request, p PathParams) error {
 	return StatusError{404, errors.New("Page not found at " + r.URL.Path)}
 }
 
+// exportGeoJSON writes the public webcams as a GeoJSON FeatureCollection to a file,
+// or to the standard output if filename is -. Links to the latest frames are
+// prefixed with baseURL.
+func exportGeoJSON(webcams []Webcam, filename string, baseURL string) {
+	controller := &WebcamController{storagePath: "hist"}
+	controller.SetWebcams(webcams)
+
+	router := NewRouter(nil)
+	if err := router.Mount("/webcam", controller); err != nil {
+		log.Fatal(err)
+	}
+	controller.SetURLBuilder(router)
+
+	collection := controller.geoJSON(nil, time.Now())
+	for i := range collection.Features {
+		if f := &collection.Features[i].Properties; f.LatestFrame != "" {
+			f.LatestFrame = strings.TrimSuffix(baseURL, "/") + f.LatestFrame
+		}
+	}
+
+	out := os.Stdout
+	if filename != "-" {
+		file, err := os.Create(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(collection); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// issueToken prints a bearer token signed with the secret of the configuration.
+func issueToken(config Config, subject string, scope string, webcams string, ttl time.Duration) {
+	grant := Grant{Subject: subject, Scope: scope}
+	for _, s := range strings.Split(webcams, ",") {
+		if s == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			log.Fatal("Invalid webcam id " + s)
+		}
+		grant.Webcams = append(grant.Webcams, id)
+	}
+
+	token, err := SignToken(config.Auth.TokenSecret, grant, time.Now().Add(ttl))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(token)
+}
+
 func main() {
+	configFile := flag.String("config", "config.json", "Path of the server configuration file")
+	token := flag.Bool("issue-token", false, "Print a bearer token and exit")
+	subject := flag.String("subject", "", "Subject of the issued token")
+	scope := flag.String("scope", scopeRead, "Scope of the issued token: read or admin")
+	tokenWebcams := flag.String("webcams", "", "Comma-separated ids of the private webcams visible with the issued token")
+	ttl := flag.Duration("ttl", 30*24*time.Hour, "Validity of the issued token")
+	geoJSONFile := flag.String("export-geojson", "", "Write the public webcams as GeoJSON to this file, - for the standard output, and exit")
+	baseURL := flag.String("base-url", "", "URL of the server, prefixed to the links of the exported GeoJSON")
+	flag.Parse()
+
+	config := loadConfig(*configFile)
+
+	if *geoJSONFile != "" {
+		exportGeoJSON(loadWebcams(), *geoJSONFile, *baseURL)
+		return
+	}
+
+	if *token {
+		issueToken(config, *subject, *scope, *tokenWebcams, *ttl)
+		return
+	}
+
+	client, err := NewFetchClient(config.Fetch)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	webcams := loadWebcams()
 
-	startCrawler(webcams)
-	startWebServer(webcams)
+	startCrawler(webcams, client)
+	startWebServer(webcams, config, client)
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// recoverPanics turns a panic in a handler into an internal server error,
+// logging the stack trace of the panic.
+func recoverPanics(next Handler) Handler {
+	return func(w http.ResponseWriter, req *http.Request, p PathParams) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				// Let the server abort the response silently, as requested
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				log.Printf("PANIC serving %s %s: %v\n%s", req.Method, req.URL.Path, v, debug.Stack())
+				err = StatusError{http.StatusInternalServerError, fmt.Errorf("Panic: %v", v)}
+			}
+		}()
+
+		return next(w, req, p)
+	}
+}
+
+// Timeout returns a middleware that cancels the context of requests after the
+// given duration. Handlers must pass the request context to slow operations,
+// such as upstream requests, for them to be interrupted. A handler failing
+// after the deadline results in a 503 Service Unavailable error.
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(w http.ResponseWriter, req *http.Request, p PathParams) error {
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+
+			err := next(w, req.WithContext(ctx), p)
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				return StatusError{http.StatusServiceUnavailable, errors.New("Request timed out after " + d.String() + ": " + err.Error())}
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// A Schema is a JSON schema, as used in OpenAPI documents.
+type Schema map[string]interface{}
+
+// A RouteDoc describes a route in the OpenAPI document of a Router.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	// Query parameters of the route. Path parameters are derived from the route path,
+	// but can be listed to add a description.
+	Params []ParamDoc
+	// Content type and schema of successful responses.
+	ContentType string
+	Schema      Schema
+}
+
+// A ParamDoc describes a parameter of a route.
+type ParamDoc struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      Schema
+}
+
+// QueryParam describes an optional query parameter.
+func QueryParam(name string, description string, schema Schema) ParamDoc {
+	return ParamDoc{name, "query", description, false, schema}
+}
+
+// PathParam describes a path parameter.
+func PathParam(name string, description string) ParamDoc {
+	return ParamDoc{name, "path", description, true, nil}
+}
+
+// openAPIVersion is the version of the OpenAPI specification of generated documents.
+const openAPIVersion = "3.0.3"
+
+// problemSchema describes the error responses sent by the Router.
+var problemSchema = Schema{
+	"type": "object",
+	"properties": Schema{
+		"type":     Schema{"type": "string"},
+		"title":    Schema{"type": "string"},
+		"status":   Schema{"type": "integer"},
+		"detail":   Schema{"type": "string"},
+		"instance": Schema{"type": "string"},
+	},
+}
+
+// ServeOpenAPI registers a route at path serving an OpenAPI document describing
+// all the routes of the router, with the given API title and version.
+func (r *Router) ServeOpenAPI(path string, title string, version string) error {
+	return r.addRoutes(path, []Route{
+		Route{
+			Method: "GET",
+			Path:   "",
+			Name:   "openapi",
+			Handler: func(w http.ResponseWriter, req *http.Request, p PathParams) error {
+				w.Header().Set("Content-Type", "application/json")
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(r.OpenAPI(title, version))
+			},
+			Doc: &RouteDoc{Summary: "OpenAPI document of this API", ContentType: "application/json", Schema: Schema{"type": "object"}},
+		},
+	}, nil, nil)
+}
+
+// OpenAPI generates an OpenAPI document from the registered routes.
+func (r *Router) OpenAPI(title string, version string) map[string]interface{} {
+	r.createRootIfNeeded()
+
+	paths := make(map[string]interface{})
+	r.root.collectPaths("", nil, paths)
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Problem": problemSchema,
+			},
+		},
+	}
+}
+
+// collectPaths adds the path items of the node and its descendants to paths.
+// prefix is the OpenAPI path of the node and params its path parameters.
+func (n *node) collectPaths(prefix string, params []ParamDoc, paths map[string]interface{}) {
+	if len(n.routes) > 0 {
+		path := prefix
+		if path == "" {
+			path = "/"
+		}
+
+		item := make(map[string]interface{})
+		for method, route := range n.routes {
+			item[strings.ToLower(method)] = route.operation(params)
+		}
+		paths[path] = item
+	}
+
+	for _, c := range n.children {
+		segment, childParams := c.value, params
+		if c.kind != literalNode {
+			segment = "{" + c.value + "}"
+			childParams = append(append([]ParamDoc{}, params...), c.paramDoc())
+		}
+
+		c.collectPaths(prefix+"/"+segment, childParams, paths)
+	}
+}
+
+// paramDoc describes the path parameter captured by the node.
+func (n *node) paramDoc() ParamDoc {
+	p := PathParam(n.value, "")
+
+	switch {
+	case n.kind == catchAllNode:
+		p.Schema = Schema{"type": "string"}
+		p.Description = "Remaining segments of the path, separated by slashes"
+	case n.kind == constrainedParamNode && n.pattern == "int":
+		p.Schema = Schema{"type": "integer", "minimum": 0}
+	case n.kind == constrainedParamNode:
+		p.Schema = Schema{"type": "string", "pattern": "^(?:" + n.pattern + ")$"}
+	default:
+		p.Schema = Schema{"type": "string"}
+	}
+
+	return p
+}
+
+// operation describes the route as an OpenAPI operation, with the given path parameters.
+func (route Route) operation(pathParams []ParamDoc) map[string]interface{} {
+	doc := route.Doc
+	if doc == nil {
+		doc = &RouteDoc{}
+	}
+
+	// Parameters documented on the route complete the ones derived from the path
+	documented := make(map[string]ParamDoc)
+	for _, p := range doc.Params {
+		documented[p.In+"/"+p.Name] = p
+	}
+
+	parameters := make([]interface{}, 0)
+	for _, p := range pathParams {
+		if d, ok := documented["path/"+p.Name]; ok {
+			p.Description = d.Description
+			if d.Schema != nil {
+				p.Schema = d.Schema
+			}
+		}
+		parameters = append(parameters, p.toOpenAPI())
+	}
+
+	for _, p := range doc.Params {
+		if p.In != "path" {
+			parameters = append(parameters, p.toOpenAPI())
+		}
+	}
+
+	success := map[string]interface{}{"description": "Successful response"}
+	if doc.ContentType != "" {
+		schema := doc.Schema
+		if schema == nil {
+			schema = Schema{"type": "string", "format": "binary"}
+		}
+		success["content"] = map[string]interface{}{
+			doc.ContentType: map[string]interface{}{"schema": schema},
+		}
+	}
+
+	op := map[string]interface{}{
+		"parameters": parameters,
+		"responses": map[string]interface{}{
+			"200": success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/problem+json": map[string]interface{}{
+						"schema": Schema{"$ref": "#/components/schemas/Problem"},
+					},
+				},
+			},
+		},
+	}
+
+	if route.Name != "" {
+		op["operationId"] = route.Name
+	}
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	if doc.Description != "" {
+		op["description"] = doc.Description
+	}
+
+	return op
+}
+
+func (p ParamDoc) toOpenAPI() map[string]interface{} {
+	schema := p.Schema
+	if schema == nil {
+		schema = Schema{"type": "string"}
+	}
+
+	param := map[string]interface{}{
+		"name":     p.Name,
+		"in":       p.In,
+		"required": p.Required || p.In == "path",
+		"schema":   schema,
+	}
+
+	if p.Description != "" {
+		param["description"] = p.Description
+	}
+
+	return param
+}
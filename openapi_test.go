@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterOpenAPI(t *testing.T) {
+	router := NewRouter(nil)
+	router.Mount("/webcam", &WebcamController{})
+	router.ServeOpenAPI("/openapi.json", "Test", "1.0")
+
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	doc := struct {
+		OpenAPI string
+		Paths   map[string]map[string]struct {
+			OperationID string
+			Parameters  []struct {
+				Name     string
+				In       string
+				Required bool
+				Schema   map[string]interface{}
+			}
+		}
+	}{}
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid OpenAPI document: %s\n", err)
+	}
+
+	for _, path := range []string{"/webcam", "/webcam/{id}", "/webcam/{id}/hist", "/webcam/{id}/hist/{name}", "/openapi.json"} {
+		if _, ok := doc.Paths[path]["get"]; !ok {
+			t.Errorf("Missing GET operation for %s\n", path)
+		}
+	}
+
+	op := doc.Paths["/webcam/{id}/hist/{name}"]["get"]
+	if op.OperationID != "webcam.frame" {
+		t.Errorf("Unexpected operation id %s\n", op.OperationID)
+	}
+
+	params := map[string]string{}
+	for _, p := range op.Parameters {
+		params[p.In+"/"+p.Name] = p.Schema["type"].(string)
+		if p.In == "path" && !p.Required {
+			t.Errorf("Path parameter %s must be required\n", p.Name)
+		}
+	}
+
+	expected := map[string]string{"path/id": "integer", "path/name": "string", "query/w": "integer", "query/fit": "string"}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("Expected parameter %s of type %s, got %q\n", k, v, params[k])
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"strings"
+	"sync"
+)
+
+const (
+	// Default and maximum number of frames in an animated preview.
+	defaultPreviewFrames = 10
+	maxPreviewFrames     = 50
+
+	// Maximum dimensions of a preview frame.
+	previewMaxWidth  = 320
+	previewMaxHeight = 240
+
+	// Delay between two preview frames, in hundredths of a second.
+	previewFrameDelay = 50
+)
+
+// A previewCache keeps the last generated preview of each webcam, so that a
+// GIF is only rebuilt when new frames are stored.
+type previewCache struct {
+	mu      sync.Mutex
+	entries map[string]previewEntry
+}
+
+type previewEntry struct {
+	frames []string
+	data   []byte
+}
+
+// get returns the cached preview built from exactly the given frames.
+func (pc *previewCache) get(key string, frames []string) ([]byte, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	entry, ok := pc.entries[key]
+	if !ok || strings.Join(entry.frames, "/") != strings.Join(frames, "/") {
+		return nil, false
+	}
+
+	return entry.data, true
+}
+
+func (pc *previewCache) set(key string, frames []string, data []byte) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.entries == nil {
+		pc.entries = make(map[string]previewEntry)
+	}
+
+	pc.entries[key] = previewEntry{frames, data}
+}
+
+// previewSize is the size of the thumbnails from which previews are built, so
+// that rebuilding a preview does not decode the original images again.
+var previewSize = resizeOptions{previewMaxWidth, previewMaxHeight, fitContain}
+
+// buildPreview creates an animated GIF from the thumbnails of the given image
+// files, in order. Files that cannot be decoded are skipped. All frames are
+// scaled to the size of the last one, so that a change of camera resolution
+// does not break the animation.
+func buildPreview(dirname string, frames []string) ([]byte, error) {
+	images := make([]image.Image, 0, len(frames))
+	for _, name := range frames {
+		data, err := readThumbnail(dirname, name, &previewSize)
+		if err != nil {
+			continue
+		}
+		img, _, err := decodeImage(data)
+		if err != nil {
+			continue
+		}
+		images = append(images, img)
+	}
+
+	if len(images) == 0 {
+		return nil, errNoFrames
+	}
+
+	last := images[len(images)-1].Bounds()
+	width, height := last.Dx(), last.Dy()
+
+	anim := &gif.GIF{}
+	for _, img := range images {
+		if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+			img = resizeImage(img, width, height)
+		}
+		anim.Image = append(anim.Image, quantizeImage(img))
+		anim.Delay = append(anim.Delay, previewFrameDelay)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, anim); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
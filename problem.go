@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// A Problem describes an error in the format of RFC 7807 problem details.
+// Extensions are additional members serialized along the standard ones.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// MarshalJSON serializes the problem and its extensions in a single object.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+
+	return json.Marshal(members)
+}
+
+// A ProblemError is an HTTPError sent to clients as a Problem. Err is the
+// internal cause of the error; it is only logged and never sent to clients.
+type ProblemError struct {
+	Problem Problem
+	Err     error
+}
+
+func (pe ProblemError) Error() string {
+	if pe.Err != nil {
+		return pe.Err.Error()
+	}
+	return pe.Problem.Detail
+}
+
+// Status returns the HTTP status code associated with the error.
+func (pe ProblemError) Status() int {
+	return pe.Problem.Status
+}
+
+// NewProblem creates a ProblemError with the given status code and public detail.
+func NewProblem(status int, detail string, cause error) ProblemError {
+	return ProblemError{Problem{Status: status, Detail: detail}, cause}
+}
+
+// problemFromError returns the problem sent to the client for an error returned by a Handler.
+// Only client errors expose their message: details of server errors stay in the logs.
+func problemFromError(err error, req *http.Request) Problem {
+	var p Problem
+
+	switch e := err.(type) {
+	case ProblemError:
+		p = e.Problem
+	case HTTPError:
+		p.Status = e.Status()
+		if p.Status < 500 {
+			p.Detail = e.Error()
+		}
+	default:
+		p.Status = http.StatusInternalServerError
+	}
+
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = req.URL.Path
+	}
+
+	return p
+}
+
+// acceptsJSON tells whether the client prefers JSON error responses. Browsers,
+// which ask for HTML or plain text without mentioning JSON, get plain text.
+func acceptsJSON(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	if strings.Contains(accept, "json") {
+		return true
+	}
+
+	return !strings.Contains(accept, "text/html") && !strings.Contains(accept, "text/plain")
+}
+
+// writeProblem sends a problem as application/problem+json or as plain text,
+// depending on the Accept header of the request.
+func writeProblem(w http.ResponseWriter, req *http.Request, p Problem) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if !acceptsJSON(req) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(p.Status)
+		fmt.Fprintln(w, p.Title)
+		if p.Detail != "" {
+			fmt.Fprintln(w, p.Detail)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Interval between two removals of the buckets that are full again.
+const rateLimitCleanupInterval = time.Minute
+
+// RateLimitConfig configures the rate limiting of API clients.
+type RateLimitConfig struct {
+	// Disabled turns rate limiting off.
+	Disabled bool `json:"disabled"`
+	// Budgets replace the default budgets if set.
+	Budgets []RateBudget `json:"budgets"`
+}
+
+// A RateBudget limits the requests of each client to a set of routes. Requests
+// consume tokens from a bucket holding up to Burst tokens, refilled at Rate
+// tokens per second.
+type RateBudget struct {
+	Name string `json:"name"`
+	// Routes are the names of the routes sharing the budget.
+	Routes []string `json:"routes"`
+	Rate   float64  `json:"rate"`
+	Burst  int      `json:"burst"`
+}
+
+// The default budgets. Live images are the most limited, as each request
+// fetches the image from the webcam.
+var defaultRateBudgets = []RateBudget{
+	RateBudget{Name: "live", Routes: []string{"webcam"}, Rate: 0.5, Burst: 10},
+	RateBudget{Name: "history", Routes: []string{"webcam.hist"}, Rate: 2, Burst: 20},
+	RateBudget{Name: "history images", Routes: []string{"webcam.frame", "webcam.preview", "webcam.at"}, Rate: 10, Burst: 100},
+}
+
+// A RateLimiter limits the rate of requests of each client, identified by
+// the subject of its grant or by its IP address.
+type RateLimiter struct {
+	budgets map[string]*RateBudget
+	now     func() time.Time
+
+	mutex       sync.Mutex
+	buckets     map[bucketKey]*tokenBucket
+	lastCleanup time.Time
+}
+
+type bucketKey struct {
+	budget *RateBudget
+	client string
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter creates a RateLimiter with the given configuration.
+func NewRateLimiter(config RateLimitConfig) (*RateLimiter, error) {
+	l := &RateLimiter{
+		budgets: make(map[string]*RateBudget),
+		now:     time.Now,
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+
+	if config.Disabled {
+		return l, nil
+	}
+
+	budgets := config.Budgets
+	if budgets == nil {
+		budgets = defaultRateBudgets
+	}
+
+	for i := range budgets {
+		b := &budgets[i]
+		if b.Rate <= 0 || b.Burst < 1 {
+			return nil, errors.New("Rate limit " + b.Name + " must have a positive rate and burst")
+		}
+
+		for _, route := range b.Routes {
+			if other, ok := l.budgets[route]; ok {
+				return nil, errors.New("Route " + route + " is limited by both " + other.Name + " and " + b.Name)
+			}
+			l.budgets[route] = b
+		}
+	}
+
+	return l, nil
+}
+
+// Middleware rejects requests exceeding the budget of their route with a 429
+// Too Many Requests error, telling clients when to retry in the Retry-After
+// header. Requests to routes without a budget are not limited.
+// It must run after the authentication middleware to identify clients by their grant.
+func (l *RateLimiter) Middleware(next Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+		budget, ok := l.budgets[RouteName(r)]
+		if !ok {
+			return next(w, r, p)
+		}
+
+		if wait := l.take(budget, clientKey(r)); wait > 0 {
+			seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+			w.Header().Set("Retry-After", seconds)
+			return StatusError{http.StatusTooManyRequests, errors.New("Rate limit of " + budget.Name + " requests exceeded, retry in " + seconds + " seconds")}
+		}
+
+		return next(w, r, p)
+	}
+}
+
+// take consumes a token of the bucket of a client, returning 0 if a token was
+// available or the duration until the next one otherwise.
+func (l *RateLimiter) take(budget *RateBudget, client string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	key := bucketKey{budget, client}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{float64(budget.Burst), now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.refill(budget, now)
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / budget.Rate * float64(time.Second))
+	}
+
+	bucket.tokens--
+	return 0
+}
+
+func (b *tokenBucket) refill(budget *RateBudget, now time.Time) {
+	b.tokens = math.Min(float64(budget.Burst), b.tokens+now.Sub(b.updated).Seconds()*budget.Rate)
+	b.updated = now
+}
+
+// cleanup periodically removes the buckets that are full again, which behave
+// like new buckets, so that the memory used does not grow with the number of clients.
+func (l *RateLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < rateLimitCleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, bucket := range l.buckets {
+		bucket.refill(key.budget, now)
+		if bucket.tokens >= float64(key.budget.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientKey identifies the client that made a request: authenticated clients
+// by the subject of their grant, which they keep whatever their address,
+// anonymous clients by their IP address.
+func clientKey(r *http.Request) string {
+	if grant := GrantFromRequest(r); grant != nil && grant.Subject != "" {
+		return "subject:" + grant.Subject
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
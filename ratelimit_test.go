@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	limiter, err := NewRateLimiter(RateLimitConfig{Budgets: []RateBudget{
+		RateBudget{Name: "live", Routes: []string{"live"}, Rate: 0.5, Burst: 2},
+		RateBudget{Name: "history", Routes: []string{"list", "image"}, Rate: 1, Burst: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.now = func() time.Time { return now }
+
+	router := NewRouter(nil)
+	router.Use(NewAuthenticator(AuthConfig{Keys: []APIKey{APIKey{"key", Grant{Subject: "app", Scope: scopeRead}}}}).Middleware, limiter.Middleware)
+	router.Mount("", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/live", Handler: helloHandler, Name: "live"},
+			Route{Method: "GET", Path: "/list", Handler: helloHandler, Name: "list"},
+			Route{Method: "GET", Path: "/image", Handler: helloHandler, Name: "image"},
+			Route{Method: "GET", Path: "/free", Handler: helloHandler},
+		},
+	})
+
+	request := func(path string, addr string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = addr
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		path       string
+		addr       string
+		key        string
+		expected   int
+		retryAfter string
+	}{
+		{"/live", "192.0.2.1:1000", "", 200, ""},
+		{"/live", "192.0.2.1:1001", "", 200, ""},
+		{"/live", "192.0.2.1:1002", "", 429, "2"},
+		// Budgets are separate for each client
+		{"/live", "192.0.2.2:1000", "", 200, ""},
+		// Authenticated clients are identified by their subject, not their address
+		{"/live", "192.0.2.1:1003", "key", 200, ""},
+		{"/live", "192.0.2.3:1000", "key", 200, ""},
+		{"/live", "192.0.2.4:1000", "key", 429, "2"},
+		// Budgets are separate for each set of routes, and shared by its routes
+		{"/list", "192.0.2.1:1004", "", 200, ""},
+		{"/image", "192.0.2.1:1005", "", 429, "1"},
+		{"/free", "192.0.2.1:1006", "", 200, ""},
+		{"/free", "192.0.2.1:1007", "", 200, ""},
+	}
+
+	for i, test := range tests {
+		rec := request(test.path, test.addr, test.key)
+		if rec.Code != test.expected || rec.Header().Get("Retry-After") != test.retryAfter {
+			t.Errorf("%d %s: expected %d with Retry-After %q, got %d with %q\n", i, test.path, test.expected, test.retryAfter, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	// Tokens are refilled over time
+	now = now.Add(2 * time.Second)
+	if rec := request("/live", "192.0.2.1:1008", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected a token to be refilled, got %d\n", rec.Code)
+	}
+	if rec := request("/live", "192.0.2.1:1009", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected only one token to be refilled, got %d\n", rec.Code)
+	}
+
+	// Full buckets are removed
+	now = now.Add(time.Hour)
+	request("/list", "192.0.2.1:1010", "")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected full buckets to be removed, got %d buckets\n", len(limiter.buckets))
+	}
+}
+
+func TestRateLimiterConfig(t *testing.T) {
+	if _, err := NewRateLimiter(RateLimitConfig{}); err != nil {
+		t.Errorf("Expected default budgets to be valid, got %v\n", err)
+	}
+
+	invalid := []RateLimitConfig{
+		RateLimitConfig{Budgets: []RateBudget{RateBudget{Name: "a", Routes: []string{"a"}, Rate: 0, Burst: 1}}},
+		RateLimitConfig{Budgets: []RateBudget{RateBudget{Name: "a", Routes: []string{"a"}, Rate: 1, Burst: 0}}},
+		RateLimitConfig{Budgets: []RateBudget{
+			RateBudget{Name: "a", Routes: []string{"a"}, Rate: 1, Burst: 1},
+			RateBudget{Name: "b", Routes: []string{"a"}, Rate: 1, Burst: 1},
+		}},
+	}
+
+	for _, config := range invalid {
+		if _, err := NewRateLimiter(config); err == nil {
+			t.Errorf("Expected an error for %v\n", config)
+		}
+	}
+}
@@ -1,29 +1,77 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// PathParams contains the parameters contained in a route.
+// PathParams contains the parameters contained in a route. A :name segment
+// captures one segment of the path, a *name segment at the end of a route
+// captures all the remaining segments, separated by slashes.
+// A parameter can be constrained with a named constraint such as :id<int> or
+// a regular expression such as :date<[0-9]{4}-[0-9]{2}-[0-9]{2}>, in which case
+// the route only matches if the whole segment satisfies the constraint.
+// Constraints cannot contain slashes.
 type PathParams map[string]string
 
+// Int returns the value of an integer parameter. A StatusError with code 400
+// is returned if the parameter is not an integer.
+func (p PathParams) Int(name string) (int, error) {
+	v, err := strconv.Atoi(p[name])
+	if err != nil {
+		return 0, StatusError{http.StatusBadRequest, errors.New("Parameter " + name + " must be an integer, got " + p[name])}
+	}
+
+	return v, nil
+}
+
+// Time returns the value of a time parameter in the given layout. A StatusError
+// with code 400 is returned if the parameter cannot be parsed.
+func (p PathParams) Time(name string, layout string) (time.Time, error) {
+	v, err := time.Parse(layout, p[name])
+	if err != nil {
+		return time.Time{}, StatusError{http.StatusBadRequest, errors.New("Parameter " + name + " must be a time in format " + layout + ", got " + p[name])}
+	}
+
+	return v, nil
+}
+
 // A Handler is a function handling requests.
 type Handler func(http.ResponseWriter, *http.Request, PathParams) error
 
-// A Route matches a method and a path to a Handler.
+// A Middleware wraps a Handler to run code before or after it. The error
+// returned by the wrapped Handler is visible to the middleware, which can
+// handle it or pass it on.
+type Middleware func(Handler) Handler
+
+// A Route matches a method and a path to a Handler. If Timeout is set,
+// the context of requests is cancelled after this duration. Routes with a
+// Name can be reversed into URLs with Router.URL. Doc describes the route
+// in the OpenAPI document of the router.
 type Route struct {
 	Method  string
 	Path    string
 	Handler Handler
+	Timeout time.Duration
+	Name    string
+	Doc     *RouteDoc
 }
 
 // A Router serves requests with its registered controllers.
 type Router struct {
 	root           *node
 	defaultHandler Handler
+	middleware     []Middleware
+	groups         []*Group
+	names          map[string]string
+	cors           *CORSConfig
 }
 
 // A Controller defines a slice of routes.
@@ -37,7 +85,9 @@ type HTTPError interface {
 	Status() int
 }
 
-// StatusError implements HTTPError interface.
+// StatusError implements HTTPError interface. The message of client errors
+// (4xx) is sent to clients, so it must not contain internal information;
+// use a ProblemError to separate the public detail from the internal cause.
 type StatusError struct {
 	Code int
 	Err  error
@@ -57,36 +107,95 @@ func NewRouter(defaultHandler Handler) *Router {
 	return &Router{
 		newTree(),
 		defaultHandler,
+		make([]Middleware, 0),
+		make([]*Group, 0),
+		make(map[string]string),
+		nil,
 	}
 }
 
-// Mount a controller on a path.
-func (r *Router) Mount(path string, controller Controller) {
+// Use adds middleware that wraps every request handled by the router,
+// including requests served by the default handler. Middleware run in
+// the order in which they are added.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Mount a controller on a path. The given middleware only wrap the routes of
+// this controller, inside the middleware added with Use.
+// An error is returned if a route conflicts with an already registered one,
+// in which case the routes of the controller preceding it stay registered.
+func (r *Router) Mount(path string, controller Controller, middleware ...Middleware) error {
+	return r.addRoutes(path, controller.GetRoutes(), middleware, nil)
+}
+
+// addRoutes registers routes under a path prefix. Routes are wrapped with their
+// timeout, then with the given middleware, then with the middleware of the group.
+func (r *Router) addRoutes(prefix string, routes []Route, middleware []Middleware, group *Group) error {
 	r.createRootIfNeeded()
 
-	for _, route := range controller.GetRoutes() {
-		route.Path = path + route.Path
-		r.root.addRoute(route)
+	for _, route := range routes {
+		route.Path = prefix + route.Path
+		if route.Timeout > 0 {
+			route.Handler = Timeout(route.Timeout)(route.Handler)
+		}
+		route.Handler = chain(route.Handler, middleware)
+		if group != nil {
+			route.Handler = group.wrap(route.Handler)
+		}
+
+		if path, ok := r.names[route.Name]; ok && route.Name != "" && path != route.Path {
+			return errors.New("Could not add route " + route.Method + " " + route.Path + ": name " + route.Name + " is already used by " + path)
+		}
+
+		if err := r.root.addRoute(route); err != nil {
+			return err
+		}
+
+		if route.Name != "" {
+			r.names[route.Name] = route.Path
+		}
 	}
+
+	return nil
 }
 
+// ServeHTTP dispatches the request to the handler of the matching route.
+// Panics in handlers and middleware are recovered into internal server errors.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	handler, params, err := r.getHandler(req)
+	if r.cors != nil {
+		if isPreflight(req) {
+			r.createRootIfNeeded()
+			if node, _ := r.root.findNode(req.URL.Path); node != nil {
+				r.cors.preflight(w, req, node.allowedMethods())
+				return
+			}
+		}
+
+		// Set the headers before calling the handler, so that error responses have them too
+		r.cors.exposeHeaders(w, req)
+	}
+
+	handler, params, name, err := r.getHandler(req)
 	if err != nil {
-		err = r.callDefaultHandler(w, req)
-	} else {
-		err = handler(w, req, params)
+		handler, params = r.notFoundHandler(req), make(PathParams)
 	}
 
+	if name != "" {
+		req = req.WithContext(context.WithValue(req.Context(), routeNameContextKey{}, name))
+	}
+
+	err = recoverPanics(chain(handler, r.middleware))(w, req, params)
+
 	if err != nil {
 		switch e := err.(type) {
 		case HTTPError:
 			log.Printf("HTTP %d : %s\n", e.Status(), e)
-			http.Error(w, http.StatusText(e.Status()), e.Status())
 		default:
 			log.Printf("ERROR: %s\n", e)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		}
+
+		writeProblem(w, req, problemFromError(err, req))
 	}
 }
 
@@ -94,90 +203,353 @@ func (r *Router) createRootIfNeeded() {
 	if r.root == nil {
 		r.root = newTree()
 	}
+
+	if r.names == nil {
+		r.names = make(map[string]string)
+	}
+}
+
+type routeNameContextKey struct{}
+
+// RouteName returns the name of the route matched by a request, or an empty
+// string if the route has no name or the request matched no route.
+func RouteName(req *http.Request) string {
+	name, _ := req.Context().Value(routeNameContextKey{}).(string)
+	return name
 }
 
-func (r *Router) getHandler(req *http.Request) (Handler, PathParams, error) {
+// getHandler returns the handler of the route matching the request, with the
+// parameters captured in its path and the name of the route.
+func (r *Router) getHandler(req *http.Request) (Handler, PathParams, string, error) {
 	r.createRootIfNeeded()
 
 	if node, params := r.root.findNode(req.URL.Path); node != nil {
 		if handler, ok := node.handlers[req.Method]; ok {
-			return handler, params, nil
+			return handler, params, node.routes[req.Method].Name, nil
 		}
 
-		return nil, nil, errors.New("No handler for method " + req.Method + " for path " + req.URL.Path)
+		// Serve HEAD requests with the GET handler, without sending the body
+		if handler, ok := node.handlers["GET"]; ok && req.Method == "HEAD" {
+			return headHandler(handler), params, node.routes["GET"].Name, nil
+		}
+
+		allow := strings.Join(node.allowedMethods(), ", ")
+
+		if req.Method == "OPTIONS" {
+			return optionsHandler(allow), params, "", nil
+		}
+
+		return methodNotAllowedHandler(allow), params, "", nil
+	}
+
+	return nil, nil, "", errors.New("No handler for path " + req.URL.Path)
+}
+
+// headHandler calls a GET handler and discards the response body.
+func headHandler(handler Handler) Handler {
+	return func(w http.ResponseWriter, req *http.Request, p PathParams) error {
+		return handler(headResponseWriter{w}, req, p)
 	}
+}
 
-	return nil, nil, errors.New("No handler for path " + req.URL.Path)
+// optionsHandler answers OPTIONS requests with the methods allowed on the path.
+func optionsHandler(allow string) Handler {
+	return func(w http.ResponseWriter, req *http.Request, p PathParams) error {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
 }
 
-func (r *Router) callDefaultHandler(w http.ResponseWriter, req *http.Request) error {
+// methodNotAllowedHandler rejects requests whose method is not handled on the path.
+func methodNotAllowedHandler(allow string) Handler {
+	return func(w http.ResponseWriter, req *http.Request, p PathParams) error {
+		w.Header().Set("Allow", allow)
+		return StatusError{http.StatusMethodNotAllowed, errors.New("No handler for method " + req.Method + " for path " + req.URL.Path)}
+	}
+}
+
+// A headResponseWriter drops everything written to the response body.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// notFoundHandler returns the handler for requests matching no route: the default
+// handler of the most specific group containing the path, if any, or the default
+// handler of the router.
+func (r *Router) notFoundHandler(req *http.Request) Handler {
+	var found *Group
+	for _, g := range r.groups {
+		if g.defaultHandler != nil && g.contains(req.URL.Path) && (found == nil || len(g.prefix) > len(found.prefix)) {
+			found = g
+		}
+	}
+
+	if found != nil {
+		return found.wrap(found.defaultHandler)
+	}
+
+	return r.callDefaultHandler
+}
+
+func (r *Router) callDefaultHandler(w http.ResponseWriter, req *http.Request, p PathParams) error {
 	if r.defaultHandler != nil {
-		return r.defaultHandler(w, req, make(PathParams))
+		return r.defaultHandler(w, req, p)
 	}
 
 	// If no default handler handler is set, return a successful empty response.
 	return nil
 }
 
+// chain wraps a handler with middleware, the first one being the outermost.
+func chain(handler Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler
+}
+
+// Kinds of nodes, in order of precedence when matching a path.
+const (
+	literalNode = iota
+	constrainedParamNode
+	paramNode
+	catchAllNode
+)
+
+// Named constraints that can be used on route parameters, as in :id<int>.
+// Any other constraint is a regular expression that must match the whole segment.
+var paramConstraints = map[string]string{
+	"int": "[0-9]+",
+}
+
 type node struct {
-	children []*node
-	value    string
-	isParam  bool
-	handlers map[string]Handler
+	children   []*node
+	value      string
+	kind       int
+	pattern    string
+	constraint *regexp.Regexp
+	handlers   map[string]Handler
+	routes     map[string]Route
+}
+
+func (n *node) isParam() bool {
+	return n.kind == paramNode || n.kind == constrainedParamNode
+}
+
+// matches tells whether a path segment can be captured by the node.
+func (n *node) matches(segment string) bool {
+	switch n.kind {
+	case literalNode:
+		return n.value == segment
+	case constrainedParamNode:
+		return n.constraint.MatchString(segment)
+	}
+	return true
+}
+
+// allowedMethods returns the sorted list of methods that can be used on the node,
+// including HEAD for nodes handling GET and OPTIONS, which are answered automatically.
+func (n *node) allowedMethods() []string {
+	methods := []string{"OPTIONS"}
+	for method := range n.handlers {
+		methods = append(methods, method)
+	}
+
+	if _, ok := n.handlers["GET"]; ok {
+		methods = append(methods, "HEAD")
+	}
+
+	sort.Strings(methods)
+
+	// Remove duplicates, if HEAD or OPTIONS are also handled explicitly
+	result := methods[:1]
+	for _, m := range methods[1:] {
+		if m != result[len(result)-1] {
+			result = append(result, m)
+		}
+	}
+
+	return result
 }
 
-func (n *node) addNode(method string, path []string, handler Handler) {
+// segment returns the path segment used to declare the node in a route.
+func (n *node) segment() string {
+	switch n.kind {
+	case paramNode:
+		return ":" + n.value
+	case constrainedParamNode:
+		return ":" + n.value + "<" + n.pattern + ">"
+	case catchAllNode:
+		return "*" + n.value
+	}
+	return n.value
+}
+
+// precedes tells whether n must be tried before other when matching a segment.
+// Constrained parameters are ordered whatever the order in which they were
+// added: named constraints first, then regular expressions, each sorted by pattern.
+func (n *node) precedes(other *node) bool {
+	if n.kind != other.kind || n.kind != constrainedParamNode {
+		return n.kind < other.kind
+	}
+
+	_, named := paramConstraints[n.pattern]
+	_, otherNamed := paramConstraints[other.pattern]
+	if named != otherNamed {
+		return named
+	}
+
+	return n.pattern < other.pattern
+}
+
+// constraintExpr returns the regular expression of the constraint of the node,
+// with named constraints expanded, or an empty string if it has none.
+func (n *node) constraintExpr() string {
+	if n.constraint == nil {
+		return ""
+	}
+	return n.constraint.String()
+}
+
+func (n *node) addNode(path []string, route Route) error {
 	if len(path) == 0 {
 		// This is the destination node, set the handler
-		n.handlers[method] = handler
-		return
+		if _, ok := n.handlers[route.Method]; ok {
+			return errors.New("A handler is already registered for this method and path")
+		}
+
+		n.handlers[route.Method] = route.Handler
+		n.routes[route.Method] = route
+		return nil
 	}
 
-	value := path[0]
+	newNode, err := parseSegment(path[0])
+	if err != nil {
+		return err
+	}
 
-	// Look for next path node in children
+	if newNode.kind == catchAllNode && len(path) > 1 {
+		return errors.New("Catch-all segment " + path[0] + " must be at the end of the route")
+	}
+
+	// Look for next path node in children. Parameters with different
+	// constraints can share a position, they are tried in the order of precedes.
 	for _, c := range n.children {
-		if c.value == value {
-			c.addNode(method, path[1:], handler)
-			return
+		if c.kind != newNode.kind || c.constraintExpr() != newNode.constraintExpr() {
+			continue
+		}
+
+		if c.value == newNode.value && c.pattern == newNode.pattern {
+			return c.addNode(path[1:], route)
 		}
+
+		// Two parameters with the same constraint at the same position would
+		// capture the same segments under different names or spellings
+		if c.kind != literalNode {
+			return errors.New("Segment " + path[0] + " conflicts with " + c.segment())
+		}
+	}
+
+	if err := newNode.addNode(path[1:], route); err != nil {
+		return err
 	}
 
-	// If not found create a new node
-	newValue := value
-	isParam := len(value) != 0 && value[0] == ':'
-	if isParam {
-		newValue = value[1:]
+	// Keep children sorted by precedence, after the existing children of the same kind
+	i := len(n.children)
+	for i > 0 && newNode.precedes(n.children[i-1]) {
+		i--
 	}
 
-	newNode := node{
-		value:    newValue,
-		isParam:  isParam,
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = newNode
+
+	return nil
+}
+
+// parseSegment creates a node from a segment of a route: a literal, a :name
+// parameter, a :name<constraint> parameter or a *name catch-all segment.
+func parseSegment(segment string) (*node, error) {
+	n := &node{
+		value:    segment,
+		kind:     literalNode,
 		handlers: make(map[string]Handler),
+		routes:   make(map[string]Route),
 	}
 
-	n.children = append(n.children, &newNode)
-	newNode.addNode(method, path[1:], handler)
+	if len(segment) == 0 {
+		return n, nil
+	}
+
+	switch segment[0] {
+	case '*':
+		n.kind = catchAllNode
+		n.value = segment[1:]
+	case ':':
+		n.kind = paramNode
+		n.value = segment[1:]
+
+		if i := strings.IndexByte(n.value, '<'); i >= 0 && strings.HasSuffix(n.value, ">") {
+			n.kind = constrainedParamNode
+			n.pattern = n.value[i+1 : len(n.value)-1]
+			n.value = n.value[:i]
+
+			expr := n.pattern
+			if named, ok := paramConstraints[expr]; ok {
+				expr = named
+			}
+
+			constraint, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, errors.New("Invalid constraint in segment " + segment + ": " + err.Error())
+			}
+			n.constraint = constraint
+		}
+	}
+
+	return n, nil
 }
 
+// traverse looks for the node matching path. Children are tried in order of
+// precedence: literal segments first, then parameters with a named constraint
+// such as int, then parameters with a regular expression, sorted by pattern,
+// then other parameters, then catch-all segments, which capture all the
+// remaining segments of the path.
 func (n *node) traverse(path []string, params PathParams) (*node, PathParams) {
-	// Stop recursion if the path is empty
+	// Stop recursion if the path is empty, nodes without handlers
+	// are only intermediate nodes of longer routes
 	if len(path) == 0 {
+		if len(n.handlers) == 0 {
+			return nil, params
+		}
 		return n, params
 	}
 
 	// Look for next path node in children
 	for _, c := range n.children {
-		if c.value == path[0] || c.isParam {
-			// Verify that the rest of the path matches a route
-			if result, _ := c.traverse(path[1:], params); result != nil {
-				// If the node is a parameter, add it in the list
-				if c.isParam {
-					params[c.value] = path[0]
-				}
-
-				return result, params
+		if c.kind == catchAllNode {
+			params[c.value] = strings.Join(path, "/")
+			return c, params
+		}
+
+		if !c.matches(path[0]) {
+			continue
+		}
+
+		// Verify that the rest of the path matches a route
+		if result, _ := c.traverse(path[1:], params); result != nil {
+			// If the node is a parameter, add it in the list
+			if c.isParam() {
+				params[c.value] = path[0]
 			}
+
+			return result, params
 		}
 	}
 
@@ -192,14 +564,19 @@ func (n *node) findNode(path string) (*node, PathParams) {
 func newTree() *node {
 	return &node{
 		value:    "",
-		isParam:  false,
+		kind:     literalNode,
 		handlers: make(map[string]Handler),
+		routes:   make(map[string]Route),
 		children: make([]*node, 0),
 	}
 }
 
-func (n *node) addRoute(r Route) {
-	n.addNode(r.Method, splitPath(r.Path), r.Handler)
+func (n *node) addRoute(r Route) error {
+	if err := n.addNode(splitPath(r.Path), r); err != nil {
+		return errors.New("Could not add route " + r.Method + " " + r.Path + ": " + err.Error())
+	}
+
+	return nil
 }
 
 func splitPath(path string) []string {
@@ -2,11 +2,14 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func helloHandler(w http.ResponseWriter, r *http.Request, p PathParams) error {
@@ -47,7 +50,7 @@ func TestRouterRootPath(t *testing.T) {
 	router := NewRouter(handlerMustNotBeCalled(t))
 	router.Mount("/", &testController{
 		[]Route{
-			Route{"GET", "/", helloHandler},
+			Route{Method: "GET", Path: "/", Handler: helloHandler},
 		},
 	})
 
@@ -70,7 +73,7 @@ func TestRouterMountPath(t *testing.T) {
 	router := NewRouter(handlerMustNotBeCalled(t))
 	router.Mount("/there", &testController{
 		[]Route{
-			Route{"GET", "/", helloHandler},
+			Route{Method: "GET", Path: "/", Handler: helloHandler},
 		},
 	})
 
@@ -93,8 +96,8 @@ func TestRouterMountPathAndControllerPath(t *testing.T) {
 	router := NewRouter(handlerMustNotBeCalled(t))
 	router.Mount("/there", &testController{
 		[]Route{
-			Route{"GET", "/here", helloHandler},
-			Route{"GET", "/", handlerMustNotBeCalled(t)},
+			Route{Method: "GET", Path: "/here", Handler: helloHandler},
+			Route{Method: "GET", Path: "/", Handler: handlerMustNotBeCalled(t)},
 		},
 	})
 
@@ -117,8 +120,8 @@ func TestRouterPathParams(t *testing.T) {
 	router := NewRouter(handlerMustNotBeCalled(t))
 	router.Mount("/", &testController{
 		[]Route{
-			Route{"GET", "/:name", helloHandler},
-			Route{"GET", "/", handlerMustNotBeCalled(t)},
+			Route{Method: "GET", Path: "/:name", Handler: helloHandler},
+			Route{Method: "GET", Path: "/", Handler: handlerMustNotBeCalled(t)},
 		},
 	})
 
@@ -141,8 +144,8 @@ func TestRouterAmbiguousPathParams(t *testing.T) {
 	router := NewRouter(handlerMustNotBeCalled(t))
 	router.Mount("/", &testController{
 		[]Route{
-			Route{"GET", "/:name", handlerMustNotBeCalled(t)},
-			Route{"GET", "/toto/:special", helloHandler},
+			Route{Method: "GET", Path: "/:name", Handler: handlerMustNotBeCalled(t)},
+			Route{Method: "GET", Path: "/toto/:special", Handler: helloHandler},
 		},
 	})
 
@@ -165,7 +168,7 @@ func TestRouterDefaultHandler(t *testing.T) {
 	router := NewRouter(helloHandler)
 	router.Mount("/", &testController{
 		[]Route{
-			Route{"GET", "/", handlerMustNotBeCalled(t)},
+			Route{Method: "GET", Path: "/", Handler: handlerMustNotBeCalled(t)},
 		},
 	})
 
@@ -185,10 +188,11 @@ func TestRouterDefaultHandler(t *testing.T) {
 }
 
 func TestRouterNotFoundMethod(t *testing.T) {
-	router := NewRouter(helloHandler)
+	router := NewRouter(handlerMustNotBeCalled(t))
 	router.Mount("/", &testController{
 		[]Route{
-			Route{"GET", "/", handlerMustNotBeCalled(t)},
+			Route{Method: "GET", Path: "/", Handler: handlerMustNotBeCalled(t)},
+			Route{Method: "PUT", Path: "/", Handler: handlerMustNotBeCalled(t)},
 		},
 	})
 
@@ -198,12 +202,61 @@ func TestRouterNotFoundMethod(t *testing.T) {
 	router.ServeHTTP(rec, req)
 	res := rec.Result()
 
-	if res.Status != "200 OK" {
-		t.Errorf("Expected 200 status code, got %s\n", res.Status)
+	if res.StatusCode != 405 {
+		t.Errorf("Expected 405 status code, got %d\n", res.StatusCode)
 	}
 
-	if getResponseBody(res) != "Hello from /" {
-		t.Errorf("Unexpected request body: %s\n", getResponseBody(res))
+	if allow := res.Header.Get("Allow"); allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Unexpected Allow header: %s\n", allow)
+	}
+}
+
+func TestRouterOptions(t *testing.T) {
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "POST", Path: "/:id", Handler: handlerMustNotBeCalled(t)},
+		},
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/1", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+	res := rec.Result()
+
+	if res.StatusCode != 204 {
+		t.Errorf("Expected 204 status code, got %d\n", res.StatusCode)
+	}
+
+	if allow := res.Header.Get("Allow"); allow != "OPTIONS, POST" {
+		t.Errorf("Unexpected Allow header: %s\n", allow)
+	}
+}
+
+func TestRouterHead(t *testing.T) {
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/", Handler: func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+				w.Header().Set("X-Test", "yes")
+				return helloHandler(w, r, p)
+			}},
+		},
+	})
+
+	req := httptest.NewRequest("HEAD", "/", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+	res := rec.Result()
+
+	if res.StatusCode != 200 || res.Header.Get("X-Test") != "yes" {
+		t.Errorf("Expected GET handler to be called, got %s\n", res.Status)
+	}
+
+	if body := getResponseBody(res); body != "" {
+		t.Errorf("Expected empty body, got %s\n", body)
 	}
 }
 
@@ -211,7 +264,7 @@ func TestRouterNotInitializedDoesNotPanic(t *testing.T) {
 	router := &Router{}
 	router.Mount("/", &testController{
 		[]Route{
-			Route{"GET", "/a", handlerMustNotBeCalled(t)},
+			Route{Method: "GET", Path: "/a", Handler: handlerMustNotBeCalled(t)},
 		},
 	})
 
@@ -230,7 +283,7 @@ func TestRouterHandlerHTTPError(t *testing.T) {
 	router := NewRouter(handlerMustNotBeCalled(t))
 	router.Mount("/", &testController{
 		[]Route{
-			Route{"GET", "/", httpErrorHandler},
+			Route{Method: "GET", Path: "/", Handler: httpErrorHandler},
 		},
 	})
 
@@ -249,7 +302,410 @@ func TestRouterHandlerError(t *testing.T) {
 	router := NewRouter(handlerMustNotBeCalled(t))
 	router.Mount("/", &testController{
 		[]Route{
-			Route{"GET", "/", errorHandler},
+			Route{Method: "GET", Path: "/", Handler: errorHandler},
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+	res := rec.Result()
+
+	if res.StatusCode != 500 {
+		t.Errorf("Expected 500 status code, got %d\n", res.StatusCode)
+	}
+}
+
+// recordingMiddleware appends its name to calls before and after calling the next handler.
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next Handler) Handler {
+		return func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+			*calls = append(*calls, name)
+			err := next(w, r, p)
+			*calls = append(*calls, "/"+name)
+			return err
+		}
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	calls := []string{}
+
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Use(recordingMiddleware("a", &calls), recordingMiddleware("b", &calls))
+	router.Mount("/there", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/:name", Handler: helloHandler},
+		},
+	}, recordingMiddleware("c", &calls))
+
+	req := httptest.NewRequest("GET", "/there/here", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	expected := "a b c /c /b /a"
+	if strings.Join(calls, " ") != expected {
+		t.Errorf("Expected calls %s, got %s\n", expected, strings.Join(calls, " "))
+	}
+
+	if getResponseBody(rec.Result()) != "Hello from /there/here" {
+		t.Errorf("Unexpected request body: %s\n", getResponseBody(rec.Result()))
+	}
+}
+
+func TestRouterMiddlewareDefaultHandler(t *testing.T) {
+	calls := []string{}
+
+	router := NewRouter(helloHandler)
+	router.Use(recordingMiddleware("a", &calls))
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/", Handler: handlerMustNotBeCalled(t)},
+		},
+	}, recordingMiddleware("b", &calls))
+
+	req := httptest.NewRequest("GET", "/notfound", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	if strings.Join(calls, " ") != "a /a" {
+		t.Errorf("Unexpected calls %s\n", strings.Join(calls, " "))
+	}
+}
+
+func TestRouterMiddlewareSeesError(t *testing.T) {
+	var seen error
+
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Use(func(next Handler) Handler {
+		return func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+			seen = next(w, r, p)
+			return nil
+		}
+	})
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/", Handler: httpErrorHandler},
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+	res := rec.Result()
+
+	if e, ok := seen.(HTTPError); !ok || e.Status() != 404 {
+		t.Errorf("Expected middleware to see the 404 error, got %v\n", seen)
+	}
+
+	if res.StatusCode != 200 {
+		t.Errorf("Expected 200 status code after the middleware handled the error, got %d\n", res.StatusCode)
+	}
+}
+
+func paramHandler(name string) Handler {
+	return func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+		fmt.Fprintf(w, "%s=%s", name, p[name])
+		return nil
+	}
+}
+
+func TestRouterCatchAll(t *testing.T) {
+	router := NewRouter(helloHandler)
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/static/*filepath", Handler: paramHandler("filepath")},
+			Route{Method: "GET", Path: "/static/index", Handler: paramHandler("none")},
+			Route{Method: "GET", Path: "/webcam/:id/hist/*path", Handler: paramHandler("path")},
+			Route{Method: "GET", Path: "/webcam/:id/hist/latest/info", Handler: paramHandler("id")},
+		},
+	})
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/static/css/main.css", "filepath=css/main.css"},
+		{"/static/index", "none="},
+		{"/static/index/more", "filepath=index/more"},
+		{"/static", "Hello from /static"},
+		{"/webcam/1/hist/2026/10/17/frame.jpg", "path=2026/10/17/frame.jpg"},
+		{"/webcam/1/hist/latest/info", "id=1"},
+		{"/webcam/1/hist/latest", "path=latest"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		if body := getResponseBody(rec.Result()); body != test.expected {
+			t.Errorf("%s: expected %s, got %s\n", test.path, test.expected, body)
+		}
+	}
+}
+
+func TestRouterLiteralPrecedence(t *testing.T) {
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/*path", Handler: paramHandler("path")},
+			Route{Method: "GET", Path: "/:id", Handler: paramHandler("id")},
+			Route{Method: "GET", Path: "/status", Handler: paramHandler("none")},
+			Route{Method: "GET", Path: "/:id/hist", Handler: paramHandler("id")},
+		},
+	})
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/status", "none="},
+		{"/3", "id=3"},
+		{"/status/hist", "id=status"},
+		{"/3/other", "path=3/other"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		if body := getResponseBody(rec.Result()); body != test.expected {
+			t.Errorf("%s: expected %s, got %s\n", test.path, test.expected, body)
+		}
+	}
+}
+
+func TestRouterConflictingRoutes(t *testing.T) {
+	tests := [][]Route{
+		{Route{Method: "GET", Path: "/a", Handler: helloHandler}, Route{Method: "GET", Path: "/a/", Handler: helloHandler}},
+		{Route{Method: "GET", Path: "/:id", Handler: helloHandler}, Route{Method: "GET", Path: "/:name", Handler: helloHandler}},
+		{Route{Method: "GET", Path: "/:id/a", Handler: helloHandler}, Route{Method: "GET", Path: "/:name/b", Handler: helloHandler}},
+		{Route{Method: "GET", Path: "/*path", Handler: helloHandler}, Route{Method: "GET", Path: "/*other", Handler: helloHandler}},
+		{Route{Method: "GET", Path: "/*path/more", Handler: helloHandler}},
+		{Route{Method: "GET", Path: "/:id<int>", Handler: helloHandler}, Route{Method: "GET", Path: "/:id<[0-9]+>/hist", Handler: helloHandler}},
+		{Route{Method: "GET", Path: "/:id<int>", Handler: helloHandler}, Route{Method: "GET", Path: "/:n<int>/hist", Handler: helloHandler}},
+	}
+
+	for _, routes := range tests {
+		router := NewRouter(nil)
+		if err := router.Mount("/", &testController{routes}); err == nil {
+			t.Errorf("Expected a conflict when mounting %v\n", routes)
+		}
+	}
+
+	router := NewRouter(nil)
+	err := router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/:id", Handler: helloHandler},
+			Route{Method: "POST", Path: "/:id", Handler: helloHandler},
+			Route{Method: "GET", Path: "/id", Handler: helloHandler},
+			Route{Method: "GET", Path: "/:id/*path", Handler: helloHandler},
+		},
+	})
+	if err != nil {
+		t.Errorf("Unexpected conflict: %s\n", err)
+	}
+}
+
+func TestRouterConstrainedParams(t *testing.T) {
+	router := NewRouter(helloHandler)
+	err := router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/:name", Handler: paramHandler("name")},
+			Route{Method: "GET", Path: "/:id<int>", Handler: paramHandler("id")},
+			Route{Method: "GET", Path: "/:day<[0-9]{4}-[0-9]{2}-[0-9]{2}>", Handler: paramHandler("day")},
+			Route{Method: "GET", Path: "/:id<int>/hist", Handler: paramHandler("id")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s\n", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/42", "id=42"},
+		{"/2026-10-17", "day=2026-10-17"},
+		{"/2026-10-1", "name=2026-10-1"},
+		{"/abc", "name=abc"},
+		{"/42/hist", "id=42"},
+		{"/abc/hist", "Hello from /abc/hist"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		if body := getResponseBody(rec.Result()); body != test.expected {
+			t.Errorf("%s: expected %s, got %s\n", test.path, test.expected, body)
+		}
+	}
+
+	if err := router.Mount("/", &testController{[]Route{Route{Method: "GET", Path: "/:x<[>", Handler: helloHandler}}}); err == nil {
+		t.Errorf("Expected an error for an invalid constraint\n")
+	}
+
+	// Overlapping constraints are tried in the same order whatever the order
+	// in which they were added: named constraints first, then by pattern
+	routes := []Route{
+		Route{Method: "GET", Path: "/:year<[0-9]{4}>", Handler: paramHandler("year")},
+		Route{Method: "GET", Path: "/:year<[0-9]{4}>/summary", Handler: paramHandler("year")},
+		Route{Method: "GET", Path: "/:id<int>", Handler: paramHandler("id")},
+		Route{Method: "GET", Path: "/:word<[A-Z]+>", Handler: paramHandler("word")},
+		Route{Method: "GET", Path: "/:code<[0-9A-F]{4}>", Handler: paramHandler("code")},
+	}
+
+	tests = []struct {
+		path     string
+		expected string
+	}{
+		{"/2026", "id=2026"},
+		{"/2026/summary", "year=2026"},
+		{"/ABCD", "code=ABCD"},
+		{"/ABCDE", "word=ABCDE"},
+	}
+
+	for _, reversed := range []bool{false, true} {
+		ordered := make([]Route, len(routes))
+		for i, route := range routes {
+			if reversed {
+				ordered[len(routes)-1-i] = route
+			} else {
+				ordered[i] = route
+			}
+		}
+
+		router = NewRouter(helloHandler)
+		if err := router.Mount("/", &testController{ordered}); err != nil {
+			t.Fatalf("Unexpected error: %s\n", err)
+		}
+
+		for _, test := range tests {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+
+			if body := getResponseBody(rec.Result()); body != test.expected {
+				t.Errorf("%s (reversed=%t): expected %s, got %s\n", test.path, reversed, test.expected, body)
+			}
+		}
+	}
+}
+
+func TestPathParamsTypedAccessors(t *testing.T) {
+	p := PathParams{"id": "12", "name": "toto", "time": "2026-10-17T08:00:00Z"}
+
+	if v, err := p.Int("id"); err != nil || v != 12 {
+		t.Errorf("Expected 12, got %d (%v)\n", v, err)
+	}
+
+	if _, err := p.Int("name"); err == nil || err.(HTTPError).Status() != 400 {
+		t.Errorf("Expected a 400 error, got %v\n", err)
+	}
+
+	if v, err := p.Time("time", time.RFC3339); err != nil || v.Hour() != 8 {
+		t.Errorf("Expected 08:00, got %s (%v)\n", v, err)
+	}
+
+	if _, err := p.Time("name", time.RFC3339); err == nil || err.(HTTPError).Status() != 400 {
+		t.Errorf("Expected a 400 error, got %v\n", err)
+	}
+}
+
+func TestRouterProblemDetails(t *testing.T) {
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/client", Handler: httpErrorHandler},
+			Route{Method: "GET", Path: "/server", Handler: errorHandler},
+			Route{Method: "GET", Path: "/problem", Handler: func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+				problem := NewProblem(http.StatusConflict, "Public detail", errors.New("/secret/path"))
+				problem.Problem.Extensions = map[string]interface{}{"webcam": 3}
+				return problem
+			}},
+		},
+	})
+
+	tests := []struct {
+		path     string
+		expected map[string]interface{}
+	}{
+		{"/client", map[string]interface{}{"status": 404.0, "title": "Not Found", "detail": "test HTTPError", "instance": "/client", "type": "about:blank"}},
+		{"/server", map[string]interface{}{"status": 500.0, "title": "Internal Server Error", "detail": nil}},
+		{"/problem", map[string]interface{}{"status": 409.0, "detail": "Public detail", "webcam": 3.0}},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+		res := rec.Result()
+
+		if ct := res.Header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s: unexpected content type %s\n", test.path, ct)
+		}
+
+		body := getResponseBody(res)
+		if strings.Contains(body, "secret") || strings.Contains(body, "test error") {
+			t.Errorf("%s: internal error leaked in %s\n", test.path, body)
+		}
+
+		problem := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(body), &problem); err != nil {
+			t.Fatalf("%s: invalid JSON %s\n", test.path, body)
+		}
+
+		for k, v := range test.expected {
+			if problem[k] != v {
+				t.Errorf("%s: expected %s=%v, got %v\n", test.path, k, v, problem[k])
+			}
+		}
+	}
+}
+
+func TestRouterProblemPlainText(t *testing.T) {
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/", Handler: httpErrorHandler},
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+	res := rec.Result()
+
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Unexpected content type %s\n", ct)
+	}
+
+	if body := getResponseBody(res); body != "Not Found\ntest HTTPError\n" {
+		t.Errorf("Unexpected body %q\n", body)
+	}
+}
+
+func TestRouterRecoversPanics(t *testing.T) {
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/", Handler: func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+				panic("Could not read configuration file")
+			}},
 		},
 	})
 
@@ -262,4 +718,135 @@ func TestRouterHandlerError(t *testing.T) {
 	if res.StatusCode != 500 {
 		t.Errorf("Expected 500 status code, got %d\n", res.StatusCode)
 	}
+
+	if body := getResponseBody(res); strings.Contains(body, "configuration") {
+		t.Errorf("Panic message leaked in %s\n", body)
+	}
+}
+
+func TestRouterRouteTimeout(t *testing.T) {
+	slowHandler := func(w http.ResponseWriter, r *http.Request, p PathParams) error {
+		select {
+		case <-r.Context().Done():
+			return r.Context().Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	}
+
+	router := NewRouter(handlerMustNotBeCalled(t))
+	router.Mount("/", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/slow", Handler: slowHandler, Timeout: 5 * time.Millisecond},
+			Route{Method: "GET", Path: "/fast", Handler: helloHandler, Timeout: 5 * time.Millisecond},
+		},
+	})
+
+	start := time.Now()
+	req := httptest.NewRequest("GET", "/slow", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	if rec.Result().StatusCode != 503 {
+		t.Errorf("Expected 503 status code, got %d\n", rec.Result().StatusCode)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Request was not interrupted\n")
+	}
+
+	req = httptest.NewRequest("GET", "/fast", nil)
+	rec = httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	if rec.Result().StatusCode != 200 {
+		t.Errorf("Expected 200 status code, got %d\n", rec.Result().StatusCode)
+	}
+}
+
+func TestRouterGroups(t *testing.T) {
+	calls := []string{}
+
+	router := NewRouter(helloHandler)
+	api := router.Group("/api", recordingMiddleware("api", &calls))
+	v1 := api.Group("/v1")
+	v1.SetDefaultHandler(paramHandler("none"))
+	v1.Mount("/webcam", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/:id<int>", Handler: paramHandler("id")},
+		},
+	}, recordingMiddleware("mount", &calls))
+	// Middleware added after mounting also apply
+	v1.Use(recordingMiddleware("v1", &calls))
+
+	tests := []struct {
+		path     string
+		expected string
+		calls    string
+	}{
+		{"/api/v1/webcam/3", "id=3", "api v1 mount /mount /v1 /api"},
+		{"/api/v1/other", "none=", "api v1 /v1 /api"},
+		{"/api/other", "Hello from /api/other", ""},
+		{"/api/v10", "Hello from /api/v10", ""},
+	}
+
+	for _, test := range tests {
+		calls = calls[:0]
+		req := httptest.NewRequest("GET", test.path, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		if body := getResponseBody(rec.Result()); body != test.expected {
+			t.Errorf("%s: expected %s, got %s\n", test.path, test.expected, body)
+		}
+
+		if got := strings.Join(calls, " "); got != test.calls {
+			t.Errorf("%s: expected calls %q, got %q\n", test.path, test.calls, got)
+		}
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	router := NewRouter(nil)
+	router.Group("/api").Mount("/webcam", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/:id<int>/hist/:name", Handler: helloHandler, Name: "frame"},
+			Route{Method: "GET", Path: "/:id<int>/files/*path", Handler: helloHandler, Name: "file"},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		params   PathParams
+		expected string
+	}{
+		{"frame", PathParams{"id": "1", "name": "2026-10-17T08:00:00+02:00.jpg"}, "/api/webcam/1/hist/2026-10-17T08:00:00+02:00.jpg"},
+		{"frame", PathParams{"id": "1", "name": "a b/c"}, "/api/webcam/1/hist/a%20b%2Fc"},
+		{"file", PathParams{"id": "2", "path": "2026/10/17"}, "/api/webcam/2/files/2026/10/17"},
+		{"frame", PathParams{"id": "x", "name": "a"}, ""},
+		{"frame", PathParams{"id": "1"}, ""},
+		{"unknown", PathParams{}, ""},
+	}
+
+	for _, test := range tests {
+		u, err := router.URL(test.name, test.params)
+		if test.expected == "" && err == nil {
+			t.Errorf("%s %v: expected an error, got %s\n", test.name, test.params, u)
+		}
+		if u != test.expected {
+			t.Errorf("%s %v: expected %s, got %s\n", test.name, test.params, test.expected, u)
+		}
+	}
+
+	err := router.Mount("/other", &testController{
+		[]Route{
+			Route{Method: "GET", Path: "/", Handler: helloHandler, Name: "frame"},
+		},
+	})
+	if err == nil {
+		t.Errorf("Expected an error for a duplicate route name\n")
+	}
 }
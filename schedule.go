@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the time zone database, for systems without one
+	_ "time/tzdata"
+)
+
+// A Schedule computes when the images of a webcam are fetched.
+type Schedule interface {
+	// Next returns the first time strictly after t at which an image must be
+	// fetched, or the zero time if no image must be fetched anymore.
+	Next(t time.Time) time.Time
+}
+
+// ScheduleConfig describes a crawl schedule, either as a cron expression or as
+// time windows with their own interval. Times are in the given time zone,
+// such as Europe/Zurich, UTC by default.
+type ScheduleConfig struct {
+	Cron     string       `json:"cron,omitempty"`
+	Timezone string       `json:"timezone,omitempty"`
+	Windows  []TimeWindow `json:"windows,omitempty"`
+	// IntervalString is the interval between fetches outside the windows.
+	// No image is fetched outside the windows if it is empty.
+	IntervalString string `json:"interval,omitempty"`
+}
+
+// A TimeWindow is a daily period, from From to To in the format 15:04, during
+// which images are fetched every IntervalString. Windows ending before they
+// start span midnight.
+type TimeWindow struct {
+	From           string `json:"from"`
+	To             string `json:"to"`
+	IntervalString string `json:"interval"`
+}
+
+// schedule returns the schedule described by the configuration.
+func (c *ScheduleConfig) schedule() (Schedule, error) {
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, errors.New("Invalid time zone " + c.Timezone)
+	}
+
+	if c.Cron != "" {
+		if len(c.Windows) > 0 || c.IntervalString != "" {
+			return nil, errors.New("A schedule cannot have both a cron expression and windows or an interval")
+		}
+		return parseCron(c.Cron, location)
+	}
+
+	s := &windowSchedule{location: location}
+
+	if c.IntervalString != "" {
+		if s.interval = myParseDuration(c.IntervalString); s.interval <= 0 {
+			return nil, errors.New("Invalid schedule interval " + c.IntervalString)
+		}
+	}
+
+	for _, w := range c.Windows {
+		window := dailyWindow{interval: myParseDuration(w.IntervalString)}
+		if window.interval <= 0 {
+			return nil, errors.New("Invalid interval " + w.IntervalString + " of window " + w.From + "-" + w.To)
+		}
+		if window.from, err = parseClock(w.From); err != nil {
+			return nil, err
+		}
+		if window.to, err = parseClock(w.To); err != nil {
+			return nil, err
+		}
+		if window.from == window.to {
+			return nil, errors.New("Window " + w.From + "-" + w.To + " is empty")
+		}
+		s.windows = append(s.windows, window)
+	}
+
+	if len(s.windows) == 0 && s.interval == 0 {
+		return nil, errors.New("A schedule needs a cron expression, windows or an interval")
+	}
+
+	return s, nil
+}
+
+// schedule returns the schedule of the image fetches of the webcam, or nil if
+// crawling is disabled.
+func (w *Webcam) schedule() (Schedule, error) {
+	var s Schedule
+
+	switch {
+	case w.Schedule != nil:
+		var err error
+		if s, err = w.Schedule.schedule(); err != nil {
+			return nil, err
+		}
+	case w.CrawlInterval() > 0:
+		s = intervalSchedule(w.CrawlInterval())
+	default:
+		return nil, nil
+	}
+
+	if w.Daylight != nil {
+		s = &daylightSchedule{s, w.Daylight, w.Position}
+	}
+
+	return s, nil
+}
+
+// An intervalSchedule fetches images at a fixed interval.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// alignedAfter returns the first time strictly after t that is a whole number of
+// intervals after base, or base if it is after t.
+func alignedAfter(base time.Time, interval time.Duration, t time.Time) time.Time {
+	if t.Before(base) {
+		return base
+	}
+	return base.Add((t.Sub(base)/interval + 1) * interval)
+}
+
+// earliest returns the earliest of two times, ignoring zero times.
+func earliest(a time.Time, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// parseClock parses a time of day in the format 15:04, returning the number of minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.New("Invalid time of day " + s + ", expected a time such as 06:30")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+type dailyWindow struct {
+	from, to int
+	interval time.Duration
+}
+
+// A windowSchedule fetches images at the interval of the window containing the
+// current time, aligned on the start of the window, and at its own interval
+// outside the windows, aligned on midnight.
+type windowSchedule struct {
+	location *time.Location
+	windows  []dailyWindow
+	interval time.Duration
+}
+
+// bounds returns the start and end of a window on the day starting at midnight.
+func (w dailyWindow) bounds(midnight time.Time) (time.Time, time.Time) {
+	y, m, d := midnight.Date()
+	start := time.Date(y, m, d, 0, w.from, 0, 0, midnight.Location())
+	if w.to < w.from {
+		d++
+	}
+	return start, time.Date(y, m, d, 0, w.to, 0, 0, midnight.Location())
+}
+
+func (s *windowSchedule) Next(t time.Time) time.Time {
+	local := t.In(s.location)
+	y, m, d := local.Date()
+
+	var next time.Time
+	for offset := -1; offset <= 1; offset++ {
+		midnight := time.Date(y, m, d+offset, 0, 0, 0, 0, s.location)
+		for _, w := range s.windows {
+			start, end := w.bounds(midnight)
+			if start.After(t) {
+				next = earliest(next, start)
+			} else if t.Before(end) {
+				if n := alignedAfter(start, w.interval, t); n.Before(end) {
+					next = earliest(next, n)
+				}
+			}
+		}
+	}
+
+	if s.interval > 0 {
+		// Fetches outside the windows, until the next start of a window
+		n := alignedAfter(time.Date(y, m, d, 0, 0, 0, 0, s.location), s.interval, t)
+		if !s.inWindow(n) {
+			next = earliest(next, n)
+		}
+	}
+
+	return next
+}
+
+// inWindow tells whether t is in one of the windows of the schedule.
+func (s *windowSchedule) inWindow(t time.Time) bool {
+	y, m, d := t.In(s.location).Date()
+	for offset := -1; offset <= 0; offset++ {
+		midnight := time.Date(y, m, d+offset, 0, 0, 0, 0, s.location)
+		for _, w := range s.windows {
+			if start, end := w.bounds(midnight); !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const (
+	// Maximum number of years searched for the next time matching a cron expression.
+	maxCronYears = 5
+
+	// Bit set of the hour field matching all hours.
+	allHours = 1<<24 - 1
+)
+
+// isRepeatedTime tells whether the local time t already happened an hour
+// earlier, before the end of daylight saving time.
+func isRepeatedTime(t time.Time) bool {
+	earlier := t.Add(-time.Hour)
+	return earlier.Day() == t.Day() && earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+// A cronSchedule fetches images at the times matching a cron expression made of
+// five fields: minute, hour, day of month, month and day of week. Fields are
+// lists of values, ranges such as 1-5, and steps such as */10 or 8-18/2. Months
+// and days of week can also be named, as in JAN or MON-FRI. As in cron, times
+// matching either the day of month or the day of week match if both are restricted.
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	anyDayOfMonth, anyDayOfWeek                bool
+	location                                   *time.Location
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+	cronMacros = map[string]string{
+		"@yearly":  "0 0 1 1 *",
+		"@monthly": "0 0 1 * *",
+		"@weekly":  "0 0 * * 0",
+		"@daily":   "0 0 * * *",
+		"@hourly":  "0 * * * *",
+	}
+)
+
+// parseCron parses a cron expression, evaluated in the given location.
+func parseCron(expr string, location *time.Location) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.New("Cron expression " + expr + " must have 5 fields")
+	}
+
+	s := &cronSchedule{location: location}
+
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.dayOfMonth, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if s.dayOfWeek, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, err
+	}
+
+	// 7 is another name for Sunday
+	if s.dayOfWeek&(1<<7) != 0 {
+		s.dayOfWeek = s.dayOfWeek&^(1<<7) | 1
+	}
+
+	s.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	s.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+
+	return s, nil
+}
+
+// parseCronField returns the set of values of a field as a bit set.
+func parseCronField(field string, min int, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return 0, errors.New("Invalid step in cron field " + field)
+			}
+			rangePart, step = part[:i], s
+		}
+
+		first, last := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+
+			var err error
+			if first, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, errors.New("Invalid value in cron field " + field)
+			}
+
+			// A single value with a step, as in 5/15, starts a range ending at the maximum
+			last = first
+			if len(bounds) == 2 {
+				if last, err = parseCronValue(bounds[1], names); err != nil {
+					return 0, errors.New("Invalid value in cron field " + field)
+				}
+			} else if step > 1 {
+				last = max
+			}
+		}
+
+		if first < min || last > max || first > last {
+			return 0, errors.New("Cron field " + field + " must be between " + strconv.Itoa(min) + " and " + strconv.Itoa(max))
+		}
+
+		for v := first; v <= last; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dow := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	// Start at the next whole minute
+	t = t.In(s.location)
+	t = t.Add(time.Duration(-t.Second())*time.Second - time.Duration(t.Nanosecond())).Add(time.Minute)
+
+	limit := t.AddDate(maxCronYears, 0, 0)
+
+	for t.Before(limit) {
+		y, m, d := t.Date()
+
+		switch {
+		case s.month&(1<<uint(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, s.location)
+		case !s.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, s.location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			// Move by absolute durations within a day, to go through daylight saving time changes
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		case s.hour != allHours && isRepeatedTime(t):
+			// Fixed times happen twice when daylight saving time ends, only fetch the first time
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// Steps used to look for the end of the night, then to refine it.
+const (
+	daylightSearchStep      = 10 * time.Minute
+	daylightSearchPrecision = time.Minute
+	daylightSearchLimit     = 366 * 24 * time.Hour
+)
+
+// A daylightSchedule follows a schedule during the day. At night, it fetches
+// images at the night interval, if it is longer, or pauses until the day.
+type daylightSchedule struct {
+	base     Schedule
+	daylight *DaylightSchedule
+	position Coordinate
+}
+
+func (s *daylightSchedule) Next(t time.Time) time.Time {
+	next := s.base.Next(t)
+	if next.IsZero() || !s.daylight.isNight(s.position, next) {
+		return next
+	}
+
+	if night := s.daylight.NightInterval(); night > 0 {
+		if n := t.Add(night); n.After(next) {
+			return n
+		}
+		return next
+	}
+
+	// Crawling is paused, wait for the first fetch of the base schedule during the day
+	for i := 0; i < 10; i++ {
+		day := s.nextDay(next)
+		if day.IsZero() {
+			return time.Time{}
+		}
+
+		if next = s.base.Next(day.Add(-time.Nanosecond)); next.IsZero() || !s.daylight.isNight(s.position, next) {
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+// nextDay returns the first time after t at which it is day, to the minute,
+// or the zero time if the night lasts for more than a year.
+func (s *daylightSchedule) nextDay(t time.Time) time.Time {
+	limit := t.Add(daylightSearchLimit)
+
+	for day := t; day.Before(limit); day = day.Add(daylightSearchStep) {
+		if s.daylight.isNight(s.position, day) {
+			continue
+		}
+
+		// Refine within the last step
+		for d := day.Add(-daylightSearchStep + daylightSearchPrecision); d.Before(day); d = d.Add(daylightSearchPrecision) {
+			if d.After(t) && !s.daylight.isNight(s.position, d) {
+				return d
+			}
+		}
+		return day
+	}
+
+	return time.Time{}
+}
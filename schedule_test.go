@@ -0,0 +1,177 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+// checkSchedule checks the times returned by successive calls to Next.
+func checkSchedule(t *testing.T, name string, s Schedule, start string, expected []string) {
+	next := mustParseTime(t, start)
+	for _, e := range expected {
+		next = s.Next(next)
+		if e == "" {
+			if !next.IsZero() {
+				t.Errorf("%s: expected no next time, got %s\n", name, next)
+			}
+			return
+		}
+		if !next.Equal(mustParseTime(t, e)) {
+			t.Errorf("%s: expected %s, got %s\n", name, e, next.UTC().Format(time.RFC3339))
+			return
+		}
+	}
+}
+
+func TestCronSchedule(t *testing.T) {
+	zurich, _ := time.LoadLocation("Europe/Zurich")
+
+	tests := []struct {
+		expr     string
+		location *time.Location
+		start    string
+		expected []string
+	}{
+		{"*/5 * * * *", time.UTC, "2026-10-19T10:02:30Z", []string{"2026-10-19T10:05:00Z", "2026-10-19T10:10:00Z"}},
+		{"0 * * * *", time.UTC, "2026-10-19T10:00:00Z", []string{"2026-10-19T11:00:00Z", "2026-10-19T12:00:00Z"}},
+		{"@hourly", time.UTC, "2026-10-19T10:59:59Z", []string{"2026-10-19T11:00:00Z"}},
+		{"30 8-18/2 * * MON-FRI", time.UTC, "2026-10-23T17:00:00Z", []string{"2026-10-23T18:30:00Z", "2026-10-26T08:30:00Z"}},
+		{"0 12 1,15 * *", time.UTC, "2026-10-19T00:00:00Z", []string{"2026-11-01T12:00:00Z", "2026-11-15T12:00:00Z"}},
+		{"0 0 29 2 *", time.UTC, "2026-10-19T00:00:00Z", []string{"2028-02-29T00:00:00Z"}},
+		// Either the day of month or the day of week matches if both are restricted
+		{"0 0 1 * 0", time.UTC, "2026-10-19T00:00:00Z", []string{"2026-10-25T00:00:00Z", "2026-11-01T00:00:00Z", "2026-11-08T00:00:00Z"}},
+		{"0 0 * * 7", time.UTC, "2026-10-19T00:00:00Z", []string{"2026-10-25T00:00:00Z"}},
+		// Local times, in summer and in winter
+		{"0 6 * * *", zurich, "2026-07-01T00:00:00Z", []string{"2026-07-01T04:00:00Z"}},
+		{"0 6 * * *", zurich, "2026-12-01T00:00:00Z", []string{"2026-12-01T05:00:00Z"}},
+		// Daylight saving time ends on 2026-10-25, 02:30 happens twice
+		{"30 2 * * *", zurich, "2026-10-24T12:00:00Z", []string{"2026-10-25T00:30:00Z", "2026-10-26T01:30:00Z"}},
+		// Daylight saving time starts on 2026-03-29, 02:30 does not exist
+		{"30 * * * *", zurich, "2026-03-29T00:00:00Z", []string{"2026-03-29T00:30:00Z", "2026-03-29T01:30:00Z"}},
+		{"0 0 31 2 *", time.UTC, "2026-10-19T00:00:00Z", []string{""}},
+	}
+
+	for _, test := range tests {
+		s, err := parseCron(test.expr, test.location)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s\n", test.expr, err)
+			continue
+		}
+		checkSchedule(t, test.expr, s, test.start, test.expected)
+	}
+
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "* * * FOO *"}
+	for _, expr := range invalid {
+		if _, err := parseCron(expr, time.UTC); err == nil {
+			t.Errorf("%q: expected an error\n", expr)
+		}
+	}
+}
+
+func TestWindowSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ScheduleConfig
+		start    string
+		expected []string
+	}{
+		{
+			"Every 5 minutes during the day, hourly otherwise",
+			ScheduleConfig{Timezone: "Europe/Zurich", IntervalString: "1h", Windows: []TimeWindow{TimeWindow{"06:00", "20:00", "5m"}}},
+			// 03:20 to 05:10 local time in winter
+			"2026-12-01T02:20:00Z",
+			[]string{"2026-12-01T03:00:00Z", "2026-12-01T04:00:00Z", "2026-12-01T05:00:00Z", "2026-12-01T05:05:00Z"},
+		},
+		{
+			"End of the window",
+			ScheduleConfig{Timezone: "Europe/Zurich", IntervalString: "1h", Windows: []TimeWindow{TimeWindow{"06:00", "20:00", "5m"}}},
+			// 19:50 local time in summer
+			"2026-07-01T17:50:00Z",
+			[]string{"2026-07-01T17:55:00Z", "2026-07-01T18:00:00Z", "2026-07-01T19:00:00Z"},
+		},
+		{
+			"No crawling outside the window",
+			ScheduleConfig{Timezone: "Europe/Zurich", Windows: []TimeWindow{TimeWindow{"06:00", "20:00", "5m"}}},
+			"2026-07-01T17:58:00Z",
+			[]string{"2026-07-02T04:00:00Z", "2026-07-02T04:05:00Z"},
+		},
+		{
+			"Window spanning midnight",
+			ScheduleConfig{Windows: []TimeWindow{TimeWindow{"22:00", "02:00", "90m"}}},
+			"2026-07-01T12:00:00Z",
+			[]string{"2026-07-01T22:00:00Z", "2026-07-01T23:30:00Z", "2026-07-02T01:00:00Z", "2026-07-02T22:00:00Z"},
+		},
+		{
+			"Several windows",
+			ScheduleConfig{IntervalString: "6h", Windows: []TimeWindow{TimeWindow{"07:00", "08:00", "30m"}, TimeWindow{"17:00", "18:00", "20m"}}},
+			"2026-07-01T07:40:00Z",
+			[]string{"2026-07-01T12:00:00Z", "2026-07-01T17:00:00Z", "2026-07-01T17:20:00Z", "2026-07-01T17:40:00Z", "2026-07-01T18:00:00Z", "2026-07-02T00:00:00Z"},
+		},
+	}
+
+	for _, test := range tests {
+		s, err := test.config.schedule()
+		if err != nil {
+			t.Errorf("%s: unexpected error %s\n", test.name, err)
+			continue
+		}
+		checkSchedule(t, test.name, s, test.start, test.expected)
+	}
+
+	invalid := []ScheduleConfig{
+		ScheduleConfig{},
+		ScheduleConfig{Timezone: "Mars/Olympus"},
+		ScheduleConfig{Cron: "* * * * *", IntervalString: "1h"},
+		ScheduleConfig{IntervalString: "never"},
+		ScheduleConfig{Windows: []TimeWindow{TimeWindow{"6:00", "25:00", "5m"}}},
+		ScheduleConfig{Windows: []TimeWindow{TimeWindow{"06:00", "06:00", "5m"}}},
+		ScheduleConfig{Windows: []TimeWindow{TimeWindow{"06:00", "20:00", ""}}},
+	}
+
+	for _, config := range invalid {
+		if _, err := config.schedule(); err == nil {
+			t.Errorf("%+v: expected an error\n", config)
+		}
+	}
+}
+
+func TestWebcamSchedule(t *testing.T) {
+	tests := []struct {
+		webcam   Webcam
+		disabled bool
+	}{
+		{Webcam{CrawlIntervalString: "0"}, true},
+		{Webcam{CrawlIntervalString: "invalid"}, true},
+		{Webcam{CrawlIntervalString: "30s"}, false},
+		{Webcam{Schedule: &ScheduleConfig{Cron: "@daily"}}, false},
+	}
+
+	for _, test := range tests {
+		s, err := test.webcam.schedule()
+		if err != nil || (s == nil) != test.disabled {
+			t.Errorf("%+v: expected disabled=%t, got %v %v\n", test.webcam, test.disabled, s, err)
+		}
+	}
+
+	if _, err := (&Webcam{Schedule: &ScheduleConfig{Cron: "invalid"}}).schedule(); err == nil {
+		t.Errorf("Expected an error for an invalid schedule\n")
+	}
+
+	// Health follows the schedule: stale after three missed fetches
+	w := Webcam{Schedule: &ScheduleConfig{Cron: "0 * * * *"}}
+	latest := mustParseTime(t, "2026-10-19T08:00:00Z")
+	if health := webcamHealth(&w, latest, mustParseTime(t, "2026-10-19T10:30:00Z")); health != healthOK {
+		t.Errorf("Expected an healthy webcam, got %s\n", health)
+	}
+	if health := webcamHealth(&w, latest, mustParseTime(t, "2026-10-19T11:00:00Z")); health != healthStale {
+		t.Errorf("Expected a stale webcam, got %s\n", health)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// Address on which the server listens by default.
+	defaultServerAddr = ":8080"
+
+	// Minimum interval between two checks of the modification of certificate files.
+	certCheckInterval = 10 * time.Second
+
+	// Maximum duration for reading the headers of a request, so that slow
+	// clients cannot keep connections open.
+	readHeaderTimeout = 10 * time.Second
+)
+
+// ServerConfig configures the listeners of the web server.
+type ServerConfig struct {
+	// Addr is the address on which requests are served, :8080 by default.
+	Addr string    `json:"addr"`
+	TLS  TLSConfig `json:"tls"`
+}
+
+// TLSConfig configures HTTPS. HTTPS is enabled when the certificate and key
+// files are set. Renewed certificates are loaded without restarting the server.
+type TLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// RedirectAddr is the address of an optional HTTP listener redirecting
+	// all requests to HTTPS, such as :80.
+	RedirectAddr string `json:"redirectAddr"`
+}
+
+// A certReloader provides the certificate loaded from a certificate and a key
+// file, reloading them when they are modified.
+type certReloader struct {
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, checkInterval: certCheckInterval}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// modificationTime returns the latest modification time of the certificate and key files.
+func (r *certReloader) modificationTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load() error {
+	modTime, err := r.modificationTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate returns the current certificate, reloading the files if they
+// were modified since they were loaded. The previous certificate is kept if the
+// new files cannot be loaded, for instance while they are being written.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastCheck) < r.checkInterval {
+		return r.cert, nil
+	}
+	r.lastCheck = now
+
+	if modTime, err := r.modificationTime(); err == nil && !modTime.Equal(r.modTime) {
+		if err := r.load(); err != nil {
+			log.Printf("ERROR: Could not reload certificate %s: %s\n", r.certFile, err)
+		} else {
+			log.Printf("Reloaded certificate %s\n", r.certFile)
+		}
+	}
+
+	return r.cert, nil
+}
+
+// newServer creates the server of the handler. It serves HTTPS if a certificate
+// is configured, in which case HTTP/2 is enabled. Requests go through a ServeMux,
+// which redirects paths containing . or .. elements or repeated slashes to their
+// clean form, as with the default handler.
+func newServer(config ServerConfig, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:              config.Addr,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	if handler != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		server.Handler = mux
+	}
+
+	if server.Addr == "" {
+		server.Addr = defaultServerAddr
+	}
+
+	if config.TLS.CertFile == "" && config.TLS.KeyFile == "" {
+		return server, nil
+	}
+
+	if config.TLS.CertFile == "" || config.TLS.KeyFile == "" {
+		return nil, errors.New("Both a certificate and a key file are required for HTTPS")
+	}
+
+	reloader, err := newCertReloader(config.TLS.CertFile, config.TLS.KeyFile)
+	if err != nil {
+		return nil, errors.New("Could not load certificate: " + err.Error())
+	}
+
+	server.TLSConfig = &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	return server, nil
+}
+
+// redirectHandler redirects requests to the same URL over HTTPS, on the port of httpsAddr.
+func redirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// serve serves the handler as configured, with the optional HTTPS redirect listener.
+func serve(config ServerConfig, handler http.Handler) error {
+	server, err := newServer(config, handler)
+	if err != nil {
+		return err
+	}
+
+	if server.TLSConfig == nil {
+		return server.ListenAndServe()
+	}
+
+	if config.TLS.RedirectAddr != "" {
+		redirect := &http.Server{
+			Addr:              config.TLS.RedirectAddr,
+			Handler:           redirectHandler(server.Addr),
+			ReadHeaderTimeout: readHeaderTimeout,
+		}
+		go func() {
+			log.Fatal(redirect.ListenAndServe())
+		}()
+	}
+
+	// The certificate is provided by the TLS configuration
+	return server.ListenAndServeTLS("", "")
+}
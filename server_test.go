@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for localhost and its key to
+// cert.pem and key.pem in dir, and returns the certificate.
+func writeSelfSignedCert(t *testing.T, dir string, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func TestServeHTTPS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert := writeSelfSignedCert(t, dir, "first")
+
+	server, err := newServer(ServerConfig{TLS: TLSConfig{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+
+	res, err := client.Get("https://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if body := getResponseBody(res); res.ProtoMajor != 2 || body != "HTTP/2.0" {
+		t.Errorf("Expected an HTTP/2 response, got %s %s\n", res.Proto, body)
+	}
+
+	if _, err := newServer(ServerConfig{TLS: TLSConfig{CertFile: filepath.Join(dir, "cert.pem")}}, nil); err == nil {
+		t.Errorf("Expected an error without key file\n")
+	}
+	if _, err := newServer(ServerConfig{TLS: TLSConfig{CertFile: filepath.Join(dir, "key.pem"), KeyFile: filepath.Join(dir, "key.pem")}}, nil); err == nil {
+		t.Errorf("Expected an error for an invalid certificate\n")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeSelfSignedCert(t, dir, "first")
+
+	reloader, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader.checkInterval = 0
+
+	commonName := func() string {
+		cert, _ := reloader.GetCertificate(nil)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf.Subject.CommonName
+	}
+
+	if name := commonName(); name != "first" {
+		t.Errorf("Expected the first certificate, got %s\n", name)
+	}
+
+	// Renew the certificate, making sure the modification time changes
+	writeSelfSignedCert(t, dir, "renewed")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "cert.pem"), later, later)
+
+	if name := commonName(); name != "renewed" {
+		t.Errorf("Expected the renewed certificate, got %s\n", name)
+	}
+
+	// An invalid certificate is ignored
+	ioutil.WriteFile(filepath.Join(dir, "cert.pem"), []byte("invalid"), 0644)
+	later = later.Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "cert.pem"), later, later)
+
+	if name := commonName(); name != "renewed" {
+		t.Errorf("Expected the renewed certificate to be kept, got %s\n", name)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		addr     string
+		host     string
+		expected string
+	}{
+		{":443", "example.com", "https://example.com/webcam/1?w=100"},
+		{":443", "example.com:80", "https://example.com/webcam/1?w=100"},
+		{":8443", "example.com:8080", "https://example.com:8443/webcam/1?w=100"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/webcam/1?w=100", nil)
+		req.Host = test.host
+		rec := httptest.NewRecorder()
+
+		redirectHandler(test.addr).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != test.expected {
+			t.Errorf("%s: expected redirect to %s, got %d %s\n", test.host, test.expected, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestServerCleanPath(t *testing.T) {
+	router := NewRouter(nil)
+	router.Mount("/webcam", &testController{[]Route{
+		Route{Method: "GET", Path: "/:id", Handler: paramHandler("id")},
+	}})
+
+	server, err := newServer(ServerConfig{}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.ReadHeaderTimeout <= 0 {
+		t.Errorf("Expected a timeout for reading request headers\n")
+	}
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/webcam/1", http.StatusOK, ""},
+		{"/webcam//1", http.StatusMovedPermanently, "/webcam/1"},
+		{"/webcam/./1", http.StatusMovedPermanently, "/webcam/1"},
+		{"/hist/../webcam/1", http.StatusMovedPermanently, "/webcam/1"},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+
+		if rec.Code != test.code || rec.Header().Get("Location") != test.location {
+			t.Errorf("%s: expected %d %s, got %d %s\n", test.path, test.code, test.location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
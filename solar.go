@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Julian date of the J2000.0 epoch, 2000-01-01 12:00 UTC.
+const julianJ2000 = 2451545.0
+
+// DaylightSchedule adapts the crawling of a webcam to the position of the sun.
+// It is night when the sun is below SunElevation degrees, 0 being the horizon
+// and -6 the end of civil twilight. At night, images are fetched every
+// NightIntervalString, or not at all if it is empty.
+type DaylightSchedule struct {
+	SunElevation        float64 `json:"sunElevation"`
+	NightIntervalString string  `json:"nightInterval,omitempty"`
+}
+
+// NightInterval returns the Duration between two image fetches at night,
+// 0 meaning that crawling is paused.
+func (d *DaylightSchedule) NightInterval() time.Duration {
+	return myParseDuration(d.NightIntervalString)
+}
+
+// isNight tells whether the sun is below the elevation of the schedule at a position and time.
+func (d *DaylightSchedule) isNight(position Coordinate, t time.Time) bool {
+	return solarElevation(position, t) < d.SunElevation
+}
+
+// isPaused tells whether crawling is paused at a position and time.
+func (d *DaylightSchedule) isPaused(position Coordinate, t time.Time) bool {
+	return d.NightInterval() <= 0 && d.isNight(position, t)
+}
+
+// solarElevation returns the elevation of the center of the sun above the
+// horizon in degrees, without atmospheric refraction. It uses the low precision
+// formulas of the Astronomical Almanac, accurate to about 0.01 degree.
+func solarElevation(position Coordinate, t time.Time) float64 {
+	// Days since J2000.0
+	n := float64(t.UnixNano())/float64(24*time.Hour) + 2440587.5 - julianJ2000
+
+	// Ecliptic coordinates of the sun
+	meanLongitude := 280.460 + 0.9856474*n
+	meanAnomaly := radians(357.528 + 0.9856003*n)
+	longitude := radians(meanLongitude + 1.915*math.Sin(meanAnomaly) + 0.020*math.Sin(2*meanAnomaly))
+	obliquity := radians(23.439 - 0.0000004*n)
+
+	// Equatorial coordinates of the sun
+	declination := math.Asin(math.Sin(obliquity) * math.Sin(longitude))
+	rightAscension := math.Atan2(math.Cos(obliquity)*math.Sin(longitude), math.Cos(longitude))
+
+	// Local hour angle, from the Greenwich mean sidereal time in degrees
+	sidereal := 280.46061837 + 360.98564736629*n
+	hourAngle := radians(sidereal+position.Lon) - rightAscension
+
+	latitude := radians(position.Lat)
+	elevation := math.Asin(math.Sin(latitude)*math.Sin(declination) + math.Cos(latitude)*math.Cos(declination)*math.Cos(hourAngle))
+
+	return elevation * 180 / math.Pi
+}
+
+func radians(degrees float64) float64 {
+	return math.Mod(degrees, 360) * math.Pi / 180
+}
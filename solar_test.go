@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var lausanne = Coordinate{46.5197, 6.6323}
+
+func TestSolarElevation(t *testing.T) {
+	tests := []struct {
+		position Coordinate
+		time     string
+		expected float64
+	}{
+		// The sun is at the zenith at the equator at noon on the equinox
+		{Coordinate{0, 0}, "2026-03-20T12:07:00Z", 89.9},
+		// Solar noon on the solstices, at 90 - latitude ± obliquity
+		{lausanne, "2026-06-21T11:35:00Z", 66.9},
+		{lausanne, "2026-12-21T11:20:00Z", 20.0},
+		{lausanne, "2026-06-21T23:35:00Z", -20.0},
+		{Coordinate{40.7128, -74.0060}, "2026-10-19T16:48:00Z", 39.1},
+		// Sunrise in Lausanne on 2026-10-19 is at 07:55 local time
+		{lausanne, "2026-10-19T05:55:00Z", -0.8},
+	}
+
+	for _, test := range tests {
+		tm, _ := time.Parse(time.RFC3339, test.time)
+		if e := solarElevation(test.position, tm); math.Abs(e-test.expected) > 0.5 {
+			t.Errorf("%v at %s: expected elevation %f, got %f\n", test.position, test.time, test.expected, e)
+		}
+	}
+}
+
+func TestDaylightSchedule(t *testing.T) {
+	day, _ := time.Parse(time.RFC3339, "2026-10-19T12:00:00Z")
+	twilight, _ := time.Parse(time.RFC3339, "2026-10-19T17:00:00Z")
+	night, _ := time.Parse(time.RFC3339, "2026-10-19T22:00:00Z")
+	// Civil dawn in Lausanne on 2026-10-20 is at 05:27 UTC, half an hour before sunrise
+	dawn, _ := time.Parse(time.RFC3339, "2026-10-20T05:27:30Z")
+
+	tests := []struct {
+		daylight *DaylightSchedule
+		time     time.Time
+		expected time.Time
+	}{
+		{nil, night, night.Add(30 * time.Second)},
+		{&DaylightSchedule{NightIntervalString: "15m"}, day, day.Add(30 * time.Second)},
+		{&DaylightSchedule{NightIntervalString: "15m"}, night, night.Add(15 * time.Minute)},
+		{&DaylightSchedule{NightIntervalString: "15m"}, twilight, twilight.Add(15 * time.Minute)},
+		{&DaylightSchedule{SunElevation: -6}, day, day.Add(30 * time.Second)},
+		{&DaylightSchedule{SunElevation: -6}, twilight, twilight.Add(30 * time.Second)},
+		{&DaylightSchedule{SunElevation: -6}, night, dawn},
+		// The sun never rises that high
+		{&DaylightSchedule{SunElevation: 80}, night, time.Time{}},
+	}
+
+	for _, test := range tests {
+		w := Webcam{Position: lausanne, CrawlIntervalString: "30s", Daylight: test.daylight}
+		schedule, _ := w.schedule()
+		if next := schedule.Next(test.time); absDuration(next.Sub(test.expected)) > time.Minute || next.IsZero() != test.expected.IsZero() {
+			t.Errorf("%+v at %s: expected %s, got %s\n", test.daylight, test.time, test.expected, next)
+		}
+	}
+
+	w := Webcam{Position: lausanne, CrawlIntervalString: "30s", Daylight: &DaylightSchedule{SunElevation: -6}}
+	if health := webcamHealth(&w, night.Add(-6*time.Hour), night); health != healthPaused {
+		t.Errorf("Expected a paused webcam, got %s\n", health)
+	}
+}
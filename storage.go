@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// Storage formats that can be configured on a webcam.
+const (
+	// storeOriginal keeps the bytes delivered by the webcam.
+	storeOriginal = "original"
+	// storeJPEG re-encodes images as JPEG.
+	storeJPEG = "jpeg"
+	// storePNG re-encodes images as PNG.
+	storePNG = "png"
+)
+
+// Quality used when re-encoding JPEG images if none is configured.
+const defaultJPEGQuality = 80
+
+// File extensions and content types of the supported image formats,
+// indexed by the names used by the image package.
+var imageExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+}
+
+var contentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// File extensions of the content types of the images that can be stored in
+// their original format, including formats that cannot be decoded.
+var contentTypeExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// detectImageFormat returns the format of an encoded image, as named by the image package.
+func detectImageFormat(data []byte) (string, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	return format, nil
+}
+
+// extensionFromContentType returns the file extension of an image given the
+// content type sent by the webcam, and whether the content type is supported.
+func extensionFromContentType(contentType string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+
+	ext, ok := contentTypeExtensions[mediaType]
+	return ext, ok
+}
+
+// encodeForStorage converts an image to the storage format configured for the
+// webcam, and returns the resulting bytes with the matching file extension.
+// Images kept in their original format are stored even if their format cannot
+// be detected, with the extension of their content type if it is supported.
+func encodeForStorage(data []byte, contentType string, w Webcam) ([]byte, string, error) {
+	target := w.StorageFormat
+
+	format, err := detectImageFormat(data)
+	if err != nil {
+		if ext, ok := extensionFromContentType(contentType); ok && (target == "" || target == storeOriginal) {
+			return data, ext, nil
+		}
+		return nil, "", errors.New("Unrecognized image format: " + err.Error())
+	}
+
+	// JPEG images are only kept as is if no quality is configured. Re-encoding
+	// PNG and GIF images in their own format would not make them smaller.
+	keep := target == "" || target == storeOriginal || (target == format && (format != storeJPEG || w.JPEGQuality == 0))
+	if keep {
+		ext, ok := imageExtensions[format]
+		if !ok {
+			return nil, "", errors.New("Unsupported image format " + format)
+		}
+		return data, ext, nil
+	}
+
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	buf := new(bytes.Buffer)
+
+	switch target {
+	case storeJPEG:
+		quality := w.JPEGQuality
+		if quality <= 0 || quality > 100 {
+			quality = defaultJPEGQuality
+		}
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	case storePNG:
+		err = png.Encode(buf, img)
+	default:
+		return nil, "", errors.New("Unknown storage format " + target)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), imageExtensions[target], nil
+}
+
+// contentTypeFromName returns the content type of a stored image given its file name.
+func contentTypeFromName(name string) string {
+	if ct, ok := contentTypes[strings.ToLower(filepath.Ext(name))]; ok {
+		return ct
+	}
+
+	return "application/octet-stream"
+}
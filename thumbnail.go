@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Maximum width and height that can be requested when resizing an image.
+	maxResizeDimension = 2048
+
+	// JPEG quality of resized images.
+	resizeQuality = 85
+
+	// Name of the folder containing resized images, inside each webcam folder.
+	thumbnailDir = ".thumbs"
+)
+
+// Widths and heights of the resized images cached on disk. Other sizes are
+// resized on each request, so that clients cannot fill the disk by requesting
+// every possible size.
+var (
+	thumbnailWidths  = []int{160, 320, 640, 1280}
+	thumbnailHeights = []int{120, 240, 480, 960}
+)
+
+// Ways of fitting an image in the requested size.
+const (
+	// fitContain scales the image to fit in the box, preserving its aspect ratio.
+	fitContain = "contain"
+	// fitCover scales and crops the image to fill the box, preserving its aspect ratio.
+	fitCover = "cover"
+	// fitFill stretches the image to the exact size of the box.
+	fitFill = "fill"
+)
+
+// resizeOptions describes how an image should be resized before being sent.
+type resizeOptions struct {
+	width  int
+	height int
+	fit    string
+}
+
+// parseResizeOptions reads the w, h and fit query parameters.
+// A nil result means that the original image was requested.
+func parseResizeOptions(query url.Values) (*resizeOptions, error) {
+	w, h, fit := query.Get("w"), query.Get("h"), query.Get("fit")
+	if w == "" && h == "" {
+		if fit != "" {
+			return nil, StatusError{http.StatusBadRequest, errors.New("fit requires w or h")}
+		}
+		return nil, nil
+	}
+
+	opts := &resizeOptions{fit: fitContain}
+
+	var err error
+	if opts.width, err = parseDimension(w); err != nil {
+		return nil, err
+	}
+	if opts.height, err = parseDimension(h); err != nil {
+		return nil, err
+	}
+
+	switch fit {
+	case "", fitContain:
+	case fitCover, fitFill:
+		if opts.width == 0 || opts.height == 0 {
+			return nil, StatusError{http.StatusBadRequest, errors.New("fit=" + fit + " requires both w and h")}
+		}
+		opts.fit = fit
+	default:
+		return nil, StatusError{http.StatusBadRequest, errors.New("Unknown fit " + fit)}
+	}
+
+	return opts, nil
+}
+
+func parseDimension(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 1 || v > maxResizeDimension {
+		return 0, StatusError{http.StatusBadRequest, fmt.Errorf("Invalid dimension %s, must be between 1 and %d", s, maxResizeDimension)}
+	}
+
+	return v, nil
+}
+
+// apply resizes img according to the options.
+func (o *resizeOptions) apply(img image.Image) image.Image {
+	b := img.Bounds()
+
+	switch o.fit {
+	case fitFill:
+		return resizeImage(img, o.width, o.height)
+	case fitCover:
+		return resizeImage(cropToAspect(img, o.width, o.height), o.width, o.height)
+	}
+
+	maxWidth, maxHeight := o.width, o.height
+	if maxWidth == 0 {
+		maxWidth = b.Dx()
+	}
+	if maxHeight == 0 {
+		maxHeight = b.Dy()
+	}
+
+	width, height := fitSize(b.Dx(), b.Dy(), maxWidth, maxHeight)
+	if width == b.Dx() && height == b.Dy() {
+		return img
+	}
+
+	return resizeImage(img, width, height)
+}
+
+// cacheable tells whether the image resized with the options is cached on disk.
+func (o *resizeOptions) cacheable() bool {
+	return isThumbnailSize(o.width, thumbnailWidths) && isThumbnailSize(o.height, thumbnailHeights)
+}
+
+func isThumbnailSize(v int, sizes []int) bool {
+	if v == 0 {
+		return true
+	}
+	for _, s := range sizes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suffix identifies the options in the name of a cached thumbnail.
+func (o *resizeOptions) suffix() string {
+	return fmt.Sprintf("%dx%d-%s", o.width, o.height, o.fit)
+}
+
+// resizeBytes decodes an image, resizes it and encodes it as JPEG.
+func resizeBytes(data []byte, opts *resizeOptions) ([]byte, error) {
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, opts.apply(img), &jpeg.Options{Quality: resizeQuality}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// thumbnailPath returns the path of the cached resized version of a stored frame.
+func thumbnailPath(dirname, name string, opts *resizeOptions) string {
+	return filepath.Join(dirname, thumbnailDir, name+"@"+opts.suffix()+".jpg")
+}
+
+// readThumbnail returns the resized version of a stored frame, creating
+// and caching it on disk if needed. Only the sizes of thumbnailWidths and
+// thumbnailHeights are cached.
+func readThumbnail(dirname, name string, opts *resizeOptions) ([]byte, error) {
+	thumbPath := thumbnailPath(dirname, name, opts)
+	if opts.cacheable() {
+		if data, err := ioutil.ReadFile(thumbPath); err == nil {
+			return data, nil
+		}
+	}
+
+	original, err := ioutil.ReadFile(filepath.Join(dirname, name))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := resizeBytes(original, opts)
+	if err != nil || !opts.cacheable() {
+		return data, err
+	}
+
+	// Write to a temporary file first so that concurrent readers never see a partial thumbnail.
+	os.MkdirAll(filepath.Dir(thumbPath), os.ModePerm)
+	tmp, err := ioutil.TempFile(filepath.Dir(thumbPath), "tmp")
+	if err != nil {
+		fmt.Printf("Could not cache thumbnail %s: %s\n", thumbPath, err)
+		return data, nil
+	}
+
+	tmp.Write(data)
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), thumbPath); err != nil {
+		fmt.Printf("Could not cache thumbnail %s: %s\n", thumbPath, err)
+		os.Remove(tmp.Name())
+	}
+
+	return data, nil
+}
+
+// pruneThumbnails deletes the cached resized images whose original frame no longer exists.
+func pruneThumbnails(dirname string) {
+	thumbs, err := ioutil.ReadDir(filepath.Join(dirname, thumbnailDir))
+	if err != nil {
+		return
+	}
+
+	for _, t := range thumbs {
+		name := t.Name()
+		if i := strings.LastIndex(name, "@"); i >= 0 {
+			name = name[:i]
+		}
+
+		if _, err := os.Stat(filepath.Join(dirname, name)); os.IsNotExist(err) {
+			os.Remove(filepath.Join(dirname, thumbnailDir, t.Name()))
+		}
+	}
+}
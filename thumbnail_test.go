@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseResizeOptions(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected *resizeOptions
+		status   int
+	}{
+		{"", nil, 0},
+		{"w=100", &resizeOptions{100, 0, fitContain}, 0},
+		{"h=50&fit=contain", &resizeOptions{0, 50, fitContain}, 0},
+		{"w=100&h=50&fit=cover", &resizeOptions{100, 50, fitCover}, 0},
+		{"w=100&h=50&fit=fill", &resizeOptions{100, 50, fitFill}, 0},
+		{"fit=cover", nil, http.StatusBadRequest},
+		{"w=100&fit=cover", nil, http.StatusBadRequest},
+		{"h=100&fit=fill", nil, http.StatusBadRequest},
+		{"w=100&fit=stretch", nil, http.StatusBadRequest},
+		{"w=0", nil, http.StatusBadRequest},
+		{"w=abc", nil, http.StatusBadRequest},
+		{"h=4096", nil, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		opts, err := parseResizeOptions(query)
+
+		if test.status != 0 {
+			if se, ok := err.(StatusError); !ok || se.Code != test.status {
+				t.Errorf("%s: expected status %d, got %v\n", test.query, test.status, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %s\n", test.query, err)
+		} else if (opts == nil) != (test.expected == nil) || (opts != nil && *opts != *test.expected) {
+			t.Errorf("%s: expected %+v, got %+v\n", test.query, test.expected, opts)
+		}
+	}
+}
+
+func TestResizeOptionsApply(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+
+	tests := []struct {
+		opts          resizeOptions
+		width, height int
+	}{
+		{resizeOptions{200, 0, fitContain}, 200, 150},
+		{resizeOptions{0, 100, fitContain}, 133, 100},
+		{resizeOptions{200, 200, fitContain}, 200, 150},
+		// Images are never scaled up
+		{resizeOptions{800, 0, fitContain}, 400, 300},
+		{resizeOptions{200, 200, fitCover}, 200, 200},
+		{resizeOptions{100, 300, fitCover}, 100, 300},
+		{resizeOptions{100, 300, fitFill}, 100, 300},
+	}
+
+	for _, test := range tests {
+		b := test.opts.apply(img).Bounds()
+		if b.Dx() != test.width || b.Dy() != test.height {
+			t.Errorf("%+v: expected %dx%d, got %dx%d\n", test.opts, test.width, test.height, b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestCropToAspect(t *testing.T) {
+	// Left half black, right half white
+	img := image.NewGray(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 200; x < 400; x++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+
+	tests := []struct {
+		width, height int
+		cropW, cropH  int
+	}{
+		{1, 1, 300, 300},
+		{16, 9, 400, 225},
+		{1, 3, 100, 300},
+		{4, 3, 400, 300},
+	}
+
+	for _, test := range tests {
+		crop := cropToAspect(img, test.width, test.height)
+		b := crop.Bounds()
+		if b.Dx() != test.cropW || b.Dy() != test.cropH {
+			t.Errorf("%d:%d: expected %dx%d, got %dx%d\n", test.width, test.height, test.cropW, test.cropH, b.Dx(), b.Dy())
+			continue
+		}
+
+		// The crop is centered: its left half is black and its right half white
+		left, _, _, _ := crop.At(b.Min.X, b.Min.Y).RGBA()
+		right, _, _, _ := crop.At(b.Max.X-1, b.Max.Y-1).RGBA()
+		if left != 0 || right != 0xffff {
+			t.Errorf("%d:%d: expected a centered crop, got %d and %d at the edges\n", test.width, test.height, left, right)
+		}
+	}
+}
+
+func TestReadThumbnail(t *testing.T) {
+	dirname := createFrames(t, nil)
+	defer os.RemoveAll(dirname)
+
+	buf := new(bytes.Buffer)
+	png.Encode(buf, image.NewGray(image.Rect(0, 0, 640, 480)))
+	name := "2026-10-17T08:00:00Z.png"
+	ioutil.WriteFile(filepath.Join(dirname, name), buf.Bytes(), 0644)
+
+	opts := &resizeOptions{320, 0, fitContain}
+	data, err := readThumbnail(dirname, name, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img, err := jpeg.Decode(bytes.NewReader(data)); err != nil || img.Bounds().Dx() != 320 || img.Bounds().Dy() != 240 {
+		t.Errorf("Expected a 320x240 JPEG thumbnail, got %v\n", err)
+	}
+
+	// The second request is served from the cache
+	thumbPath := thumbnailPath(dirname, name, opts)
+	if _, err := os.Stat(thumbPath); err != nil {
+		t.Fatalf("Expected a cached thumbnail: %s\n", err)
+	}
+	ioutil.WriteFile(thumbPath, []byte("cached"), 0644)
+	if data, _ := readThumbnail(dirname, name, opts); string(data) != "cached" {
+		t.Errorf("Expected the cached thumbnail, got %d bytes\n", len(data))
+	}
+
+	// Other sizes are resized without being cached
+	opts = &resizeOptions{321, 0, fitContain}
+	if data, err := readThumbnail(dirname, name, opts); err != nil || len(data) == 0 {
+		t.Errorf("Expected a thumbnail, got %v\n", err)
+	}
+	if _, err := os.Stat(thumbnailPath(dirname, name, opts)); !os.IsNotExist(err) {
+		t.Errorf("Expected no cached thumbnail for %+v\n", opts)
+	}
+
+	// Thumbnails of deleted frames are pruned
+	os.Remove(filepath.Join(dirname, name))
+	pruneThumbnails(dirname)
+	if thumbs, _ := ioutil.ReadDir(filepath.Join(dirname, thumbnailDir)); len(thumbs) != 0 {
+		t.Errorf("Expected no thumbnail after pruning, got %d\n", len(thumbs))
+	}
+}
+
+func TestDecodeImageLimit(t *testing.T) {
+	buf := new(bytes.Buffer)
+	gif.Encode(buf, image.NewGray(image.Rect(0, 0, 4, 3)), nil)
+
+	// Declare a logical screen of 60000x60000 pixels in the header
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data[6:], 60000)
+	binary.LittleEndian.PutUint16(data[8:], 60000)
+
+	if _, err := resizeBytes(data, &resizeOptions{100, 0, fitContain}); err == nil {
+		t.Errorf("Expected an error when resizing a huge image\n")
+	}
+	if _, _, err := encodeForStorage(data, "image/gif", Webcam{StorageFormat: storePNG}); err == nil {
+		t.Errorf("Expected an error when re-encoding a huge image\n")
+	}
+
+	if _, err := resizeBytes(imageData, &resizeOptions{2, 0, fitContain}); err != nil {
+		t.Errorf("Unexpected error %s\n", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// The files of the web UI, embedded in the binary.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// The UI only loads its own files and the images of the API.
+const uiContentSecurityPolicy = "default-src 'self'; img-src 'self' blob:; object-src 'none'; base-uri 'none'; frame-ancestors 'none'"
+
+// A UIController serves the web UI, showing the webcams on a map, their latest
+// images and their history. The UI uses the GeoJSON and history routes.
+type UIController struct{}
+
+// GetRoutes returns the routes handled by this controller.
+func (c *UIController) GetRoutes() []Route {
+	return []Route{
+		Route{Method: "GET", Path: "/", Handler: c.sendIndex, Name: "ui", Doc: &RouteDoc{
+			Summary:     "Get the web UI",
+			ContentType: "text/html",
+		}},
+		Route{Method: "GET", Path: "/ui/*file", Handler: c.sendFile, Name: "ui.file", Doc: &RouteDoc{
+			Summary: "Get a file of the web UI",
+		}},
+	}
+}
+
+func (c *UIController) sendIndex(w http.ResponseWriter, r *http.Request, p PathParams) error {
+	return serveUIFile(w, r, "ui/index.html")
+}
+
+func (c *UIController) sendFile(w http.ResponseWriter, r *http.Request, p PathParams) error {
+	return serveUIFile(w, r, "ui/"+p["file"])
+}
+
+// serveUIFile serves an embedded file, with an ETag so that browsers revalidate
+// their cached copy after an upgrade.
+func serveUIFile(w http.ResponseWriter, r *http.Request, name string) error {
+	if !fs.ValidPath(name) {
+		return StatusError{http.StatusNotFound, errors.New("No UI file " + name)}
+	}
+
+	data, err := uiFiles.ReadFile(name)
+	if err != nil {
+		return StatusError{http.StatusNotFound, errors.New("No UI file " + name)}
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", uiContentSecurityPolicy)
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+	return nil
+}
@@ -0,0 +1,384 @@
+(function () {
+  "use strict";
+
+  // Widths of the thumbnails cached by the server
+  var THUMBNAIL_WIDTH = 640;
+  var VIEWER_WIDTH = 1280;
+  var HISTORY_PAGE_SIZE = 10000;
+  var PLAY_INTERVAL = 200;
+
+  var apiKey = localStorage.getItem("apiKey") || "";
+  var webcams = [];
+  var viewer = { webcam: null, frames: [], playing: null, loading: 0 };
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function svg(name, attributes) {
+    var element = document.createElementNS("http://www.w3.org/2000/svg", name);
+    Object.keys(attributes || {}).forEach(function (key) {
+      element.setAttribute(key, attributes[key]);
+    });
+    return element;
+  }
+
+  function showError(message) {
+    $("error").textContent = message;
+    $("error").hidden = !message;
+  }
+
+  // fetchAPI requests a path of the API, sending the API key if one is set.
+  function fetchAPI(path) {
+    var headers = apiKey ? { "X-API-Key": apiKey } : {};
+    return fetch(path, { headers: headers }).then(function (res) {
+      if (!res.ok) {
+        return res.text().then(function (text) {
+          var detail = text;
+          try {
+            detail = JSON.parse(text).detail || text;
+          } catch (e) {
+            // Not a problem document
+          }
+          throw new Error(res.status + " " + res.statusText + (detail ? ": " + detail : ""));
+        });
+      }
+      return res;
+    });
+  }
+
+  // loadImage displays an image of the API. Images are fetched with the API key
+  // if one is set, since images elements cannot send headers.
+  function loadImage(img, path) {
+    if (!apiKey) {
+      img.src = path;
+      return Promise.resolve();
+    }
+
+    return fetchAPI(path)
+      .then(function (res) {
+        return res.blob();
+      })
+      .then(function (blob) {
+        if (img.dataset.objectURL) {
+          URL.revokeObjectURL(img.dataset.objectURL);
+        }
+        img.dataset.objectURL = URL.createObjectURL(blob);
+        img.src = img.dataset.objectURL;
+      });
+  }
+
+  function withWidth(path, width) {
+    return path + (path.indexOf("?") < 0 ? "?" : "&") + "w=" + width;
+  }
+
+  function formatTime(time) {
+    return time ? new Date(time).toLocaleString() : "No image";
+  }
+
+  function healthBadge(health) {
+    var badge = document.createElement("span");
+    badge.className = "health health-" + health;
+    badge.textContent = health;
+    return badge;
+  }
+
+  // Map
+
+  // drawMap plots the webcams with an equirectangular projection fitted to their positions.
+  function drawMap() {
+    var map = $("map");
+    while (map.firstChild) {
+      map.removeChild(map.firstChild);
+    }
+
+    if (webcams.length === 0) {
+      return;
+    }
+
+    var lons = webcams.map(function (w) { return w.lon; });
+    var lats = webcams.map(function (w) { return w.lat; });
+    var margin = 0.5;
+    var minLon = Math.min.apply(null, lons) - margin;
+    var maxLon = Math.max.apply(null, lons) + margin;
+    var minLat = Math.min.apply(null, lats) - margin;
+    var maxLat = Math.max.apply(null, lats) + margin;
+
+    // Keep distances comparable in both directions at the latitude of the webcams
+    var scaleX = Math.cos(((minLat + maxLat) / 2) * Math.PI / 180);
+    var width = 1000;
+    var height = 500;
+    var scale = Math.min(width / ((maxLon - minLon) * scaleX), height / (maxLat - minLat));
+    var offsetX = (width - (maxLon - minLon) * scaleX * scale) / 2;
+    var offsetY = (height - (maxLat - minLat) * scale) / 2;
+
+    function project(lon, lat) {
+      return [offsetX + (lon - minLon) * scaleX * scale, offsetY + (maxLat - lat) * scale];
+    }
+
+    // Graticule every degree, or every 10 degrees on large maps
+    var step = maxLon - minLon > 30 || maxLat - minLat > 30 ? 10 : 1;
+    for (var lon = Math.ceil(minLon / step) * step; lon <= maxLon; lon += step) {
+      var top = project(lon, maxLat);
+      var bottom = project(lon, minLat);
+      map.appendChild(svg("line", { "class": "graticule", x1: top[0], y1: top[1], x2: bottom[0], y2: bottom[1] }));
+    }
+    for (var lat = Math.ceil(minLat / step) * step; lat <= maxLat; lat += step) {
+      var left = project(minLon, lat);
+      var right = project(maxLon, lat);
+      map.appendChild(svg("line", { "class": "graticule", x1: left[0], y1: left[1], x2: right[0], y2: right[1] }));
+    }
+
+    webcams.forEach(function (webcam) {
+      var point = project(webcam.lon, webcam.lat);
+      var marker = svg("circle", {
+        "class": "marker health-" + webcam.health,
+        cx: point[0],
+        cy: point[1],
+        r: 8,
+        tabindex: 0,
+        role: "button"
+      });
+      var title = svg("title");
+      title.textContent = webcam.name + " (" + webcam.health + ")";
+      marker.appendChild(title);
+      marker.addEventListener("click", function () { openViewer(webcam); });
+      marker.addEventListener("keydown", function (e) {
+        if (e.key === "Enter") {
+          openViewer(webcam);
+        }
+      });
+      map.appendChild(marker);
+
+      var label = svg("text", { x: point[0] + 12, y: point[1] + 5 });
+      label.textContent = webcam.name;
+      map.appendChild(label);
+    });
+  }
+
+  // Gallery
+
+  function drawGallery() {
+    var gallery = $("gallery");
+    gallery.textContent = "";
+
+    webcams.forEach(function (webcam) {
+      var card = document.createElement("button");
+      card.type = "button";
+      card.className = "card";
+      card.addEventListener("click", function () { openViewer(webcam); });
+
+      var img = document.createElement("img");
+      img.alt = webcam.name;
+      img.loading = "lazy";
+      if (webcam.latestFrame) {
+        loadImage(img, withWidth(webcam.latestFrame, THUMBNAIL_WIDTH)).catch(function () {});
+      }
+      card.appendChild(img);
+
+      var caption = document.createElement("div");
+      caption.className = "caption";
+
+      var name = document.createElement("strong");
+      name.textContent = webcam.name;
+      caption.appendChild(name);
+      caption.appendChild(healthBadge(webcam.health));
+
+      var time = document.createElement("div");
+      time.className = "time";
+      time.textContent = formatTime(webcam.lastSuccess);
+      caption.appendChild(time);
+
+      card.appendChild(caption);
+      gallery.appendChild(card);
+    });
+  }
+
+  // Viewer with the timeline scrubber
+
+  // loadHistory lists all the stored frames of a webcam, following the pages of the history.
+  function loadHistory(id) {
+    var frames = [];
+
+    function loadPage(cursor) {
+      var path = "webcam/" + id + "/hist?limit=" + HISTORY_PAGE_SIZE + (cursor ? "&cursor=" + encodeURIComponent(cursor) : "");
+      return fetchAPI(path)
+        .then(function (res) { return res.json(); })
+        .then(function (page) {
+          frames = frames.concat(page.frames);
+          return page.next ? loadPage(page.next) : frames;
+        });
+    }
+
+    return loadPage("");
+  }
+
+  function openViewer(webcam) {
+    stopPlaying();
+    viewer.webcam = webcam;
+    viewer.frames = [];
+
+    $("viewer-title").textContent = webcam.name;
+    $("viewer-time").textContent = "Loading…";
+    $("viewer-image").removeAttribute("src");
+    $("timeline").max = 0;
+    $("viewer").hidden = false;
+
+    loadHistory(webcam.id)
+      .then(function (frames) {
+        if (viewer.webcam !== webcam) {
+          return;
+        }
+        viewer.frames = frames;
+        $("timeline").max = Math.max(0, frames.length - 1);
+        showFrame(frames.length - 1);
+      })
+      .catch(function (err) {
+        $("viewer-time").textContent = err.message;
+      });
+  }
+
+  function closeViewer() {
+    stopPlaying();
+    viewer.webcam = null;
+    $("viewer").hidden = true;
+  }
+
+  function showFrame(index) {
+    var frames = viewer.frames;
+    if (frames.length === 0) {
+      $("viewer-time").textContent = "No image stored";
+      return;
+    }
+
+    index = Math.max(0, Math.min(frames.length - 1, index));
+    $("timeline").value = index;
+
+    var frame = frames[index];
+    $("viewer-time").textContent = formatTime(frame.time) + " (" + (index + 1) + "/" + frames.length + ")";
+
+    // Ignore images that finish loading after a more recent request
+    var request = ++viewer.loading;
+    var img = $("viewer-image");
+    img.alt = viewer.webcam.name + " at " + formatTime(frame.time);
+    if (apiKey) {
+      var buffer = new Image();
+      loadImage(buffer, withWidth(frame.url, VIEWER_WIDTH)).then(function () {
+        if (request !== viewer.loading) {
+          URL.revokeObjectURL(buffer.dataset.objectURL);
+          return;
+        }
+        if (img.dataset.objectURL) {
+          URL.revokeObjectURL(img.dataset.objectURL);
+        }
+        img.dataset.objectURL = buffer.dataset.objectURL;
+        img.src = buffer.src;
+      }).catch(function (err) {
+        showError(err.message);
+      });
+    } else {
+      img.src = withWidth(frame.url, VIEWER_WIDTH);
+    }
+  }
+
+  function currentIndex() {
+    return parseInt($("timeline").value, 10);
+  }
+
+  function stopPlaying() {
+    if (viewer.playing) {
+      clearInterval(viewer.playing);
+      viewer.playing = null;
+    }
+    $("play").textContent = "Play";
+  }
+
+  function togglePlaying() {
+    if (viewer.playing) {
+      stopPlaying();
+      return;
+    }
+
+    if (currentIndex() >= viewer.frames.length - 1) {
+      showFrame(0);
+    }
+
+    $("play").textContent = "Pause";
+    viewer.playing = setInterval(function () {
+      if (currentIndex() >= viewer.frames.length - 1) {
+        stopPlaying();
+        return;
+      }
+      showFrame(currentIndex() + 1);
+    }, PLAY_INTERVAL);
+  }
+
+  // Loading
+
+  function loadWebcams() {
+    showError("");
+    return fetchAPI("webcam.geojson")
+      .then(function (res) { return res.json(); })
+      .then(function (collection) {
+        webcams = collection.features.map(function (feature) {
+          var p = feature.properties;
+          return {
+            id: p.id,
+            name: p.name,
+            health: p.health,
+            lastSuccess: p.lastSuccess,
+            latestFrame: p.latestFrame,
+            lon: feature.geometry.coordinates[0],
+            lat: feature.geometry.coordinates[1]
+          };
+        });
+        drawMap();
+        drawGallery();
+      })
+      .catch(function (err) {
+        showError("Could not load the webcams: " + err.message);
+      });
+  }
+
+  $("api-key").value = apiKey;
+  $("credentials").addEventListener("submit", function (e) {
+    e.preventDefault();
+    apiKey = $("api-key").value.trim();
+    if (apiKey) {
+      localStorage.setItem("apiKey", apiKey);
+    } else {
+      localStorage.removeItem("apiKey");
+    }
+    loadWebcams();
+  });
+
+  $("viewer-close").addEventListener("click", closeViewer);
+  $("timeline").addEventListener("input", function () {
+    stopPlaying();
+    showFrame(currentIndex());
+  });
+  $("previous").addEventListener("click", function () {
+    stopPlaying();
+    showFrame(currentIndex() - 1);
+  });
+  $("next").addEventListener("click", function () {
+    stopPlaying();
+    showFrame(currentIndex() + 1);
+  });
+  $("play").addEventListener("click", togglePlaying);
+
+  document.addEventListener("keydown", function (e) {
+    if ($("viewer").hidden) {
+      return;
+    }
+    if (e.key === "Escape") {
+      closeViewer();
+    } else if (e.key === "ArrowLeft" && e.target !== $("timeline")) {
+      showFrame(currentIndex() - 1);
+    } else if (e.key === "ArrowRight" && e.target !== $("timeline")) {
+      showFrame(currentIndex() + 1);
+    }
+  });
+
+  loadWebcams();
+})();
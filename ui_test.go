@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/fs"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestUIFiles(t *testing.T) {
+	authenticator := NewAuthenticator(AuthConfig{Required: true})
+	authenticator.AllowAnonymous("ui", "ui.file")
+
+	router := NewRouter(nil)
+	router.Use(authenticator.Middleware)
+	router.Mount("", &UIController{})
+	router.Mount("", &GeoJSONController{&WebcamController{}})
+
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+	}{
+		{"/", 200, "text/html; charset=utf-8"},
+		{"/ui/app.js", 200, "text/javascript; charset=utf-8"},
+		{"/ui/style.css", 200, "text/css; charset=utf-8"},
+		{"/ui/index.html", 200, "text/html; charset=utf-8"},
+		{"/ui/missing.js", 404, ""},
+		{"/ui/..%2Fui.go", 404, ""},
+		{"/ui/%2E%2E/ui.go", 404, ""},
+		// Other routes still require credentials
+		{"/webcam.geojson", 401, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != test.code {
+			t.Errorf("%s: expected %d, got %d\n", test.path, test.code, rec.Code)
+		}
+		if test.contentType != "" && rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%s: expected %s, got %s\n", test.path, test.contentType, rec.Header().Get("Content-Type"))
+		}
+		if test.code == 200 && rec.Header().Get("Content-Security-Policy") == "" {
+			t.Errorf("%s: expected a Content-Security-Policy\n", test.path)
+		}
+	}
+
+	// Cached copies are revalidated with the ETag
+	req := httptest.NewRequest("GET", "/ui/app.js", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	req = httptest.NewRequest("GET", "/ui/app.js", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != 304 {
+		t.Errorf("Expected 304 for an unchanged file, got %d\n", rec.Code)
+	}
+}
+
+func TestUIHasNoExternalDependencies(t *testing.T) {
+	external := regexp.MustCompile(`(?i)(src|href)\s*=\s*["']?(https?:)?//|url\(\s*["']?(https?:)?//|fetch\(\s*["'](https?:)?//|@import`)
+
+	fs.WalkDir(uiFiles, "ui", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, _ := uiFiles.ReadFile(name)
+		if match := external.Find(data); match != nil {
+			t.Errorf("%s references an external resource: %s\n", name, match)
+		}
+		if strings.HasSuffix(name, ".html") && !strings.Contains(string(data), `src="ui/app.js"`) {
+			t.Errorf("%s does not load the embedded script\n", name)
+		}
+		return nil
+	})
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -22,6 +24,13 @@ type Webcam struct {
 	Position            Coordinate `json:"position"`
 	CrawlIntervalString string     `json:"crawlInterval"`
 	MaxAgeString        string     `json:"maxAge"`
+	StorageFormat       string     `json:"storageFormat,omitempty"`
+	JPEGQuality         int        `json:"jpegQuality,omitempty"`
+	Private             bool       `json:"private,omitempty"`
+	// Schedule replaces the crawl interval with a cron or time window schedule, if set.
+	Schedule *ScheduleConfig `json:"schedule,omitempty"`
+	// Daylight adapts the crawling to the position of the sun at Position, if set.
+	Daylight *DaylightSchedule `json:"daylight,omitempty"`
 }
 
 // CrawlInterval returns the Duration between two image fetches.
@@ -35,20 +44,38 @@ func (w *Webcam) MaxAge() time.Duration {
 }
 
 func (w *Webcam) getImage(client *http.Client) ([]byte, error) {
-	r, err := client.Get(w.URL)
+	body, _, err := w.getImageContext(context.Background(), client)
+	return body, err
+}
 
+// getImageContext fetches the current webcam image, aborting when ctx is done.
+// It returns the image with the content type sent by the webcam.
+func (w *Webcam) getImageContext(ctx context.Context, client *http.Client) ([]byte, string, error) {
+	req, err := http.NewRequest("GET", w.URL, nil)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	r, err := client.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return nil, "", err
 	}
 
 	defer r.Body.Close()
 
-	body, err := ioutil.ReadAll(r.Body)
+	// The configured size is enforced by the client of NewFetchClient. Never
+	// read more than the absolute maximum, whatever the client.
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, absoluteMaxImageSize+1))
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	if len(body) > absoluteMaxImageSize {
+		return nil, "", errResponseTooLarge
 	}
 
-	return body, nil
+	return body, r.Header.Get("Content-Type"), nil
 }
 
 func myParseDuration(duration string) time.Duration {
@@ -5,113 +5,537 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // WebcamController struct contains the webcam data and provides methods to handle HTTP requests.
 type WebcamController struct {
 	client      http.Client
 	webcams     []Webcam
+	index       *spatialIndex
 	storagePath string
+	timeFormat  string
+	previews    previewCache
+	history     historyIndex
+	urls        URLBuilder
 }
 
+// Maximum duration of a request for a live image, including the upstream request.
+const liveImageTimeout = 15 * time.Second
+
+var errNoFrames = errors.New("No frames stored for this webcam")
+
 // SetWebcams sets the list of webcams that the controller can display.
 func (c *WebcamController) SetWebcams(webcams []Webcam) {
 	c.webcams = webcams
+	c.index = newSpatialIndex(webcams)
+}
+
+// SetURLBuilder sets the builder used to link to the routes of the controller in responses.
+func (c *WebcamController) SetURLBuilder(urls URLBuilder) {
+	c.urls = urls
 }
 
 // GetRoutes returns the routes handled by this controller.
 func (c *WebcamController) GetRoutes() []Route {
 	return []Route{
-		Route{"GET", "/", c.sendWebcamList},
-		Route{"GET", "/:id", c.sendWebcam},
-		Route{"GET", "/:id/hist", c.sendHist},
-		Route{"GET", "/:id/hist/:name", c.sendHistWebcam},
+		Route{Method: "GET", Path: "/", Handler: c.sendWebcamList, Name: "webcams", Doc: &RouteDoc{
+			Summary: "List webcams",
+			Params: []ParamDoc{
+				QueryParam("near", "Sort webcams by distance to this position, as lat,lon", nil),
+				QueryParam("radius", "Only list webcams within this distance to near, in kilometers", Schema{"type": "number", "exclusiveMinimum": 0}),
+				QueryParam("bbox", "Only list webcams in this bounding box, as minLon,minLat,maxLon,maxLat", nil),
+			},
+			ContentType: "application/json",
+			Schema:      Schema{"type": "array", "items": webcamSchema},
+		}},
+		Route{Method: "GET", Path: "/:id<int>", Handler: c.sendWebcam, Timeout: liveImageTimeout, Name: "webcam", Doc: &RouteDoc{
+			Summary:     "Get the live image of a webcam",
+			Params:      append([]ParamDoc{webcamIDParam}, resizeParams...),
+			ContentType: "image/*",
+		}},
+		Route{Method: "GET", Path: "/:id<int>/hist", Handler: c.sendHist, Name: "webcam.hist", Doc: &RouteDoc{
+			Summary: "List the stored images of a webcam",
+			Params: []ParamDoc{
+				webcamIDParam,
+				QueryParam("from", "Only list images taken at or after this time", Schema{"type": "string", "format": "date-time"}),
+				QueryParam("to", "Only list images taken at or before this time", Schema{"type": "string", "format": "date-time"}),
+				QueryParam("limit", "Maximum number of images in the page", Schema{"type": "integer", "minimum": 1, "maximum": maxHistoryLimit, "default": defaultHistoryLimit}),
+				QueryParam("cursor", "Cursor of the page, as returned in next", nil),
+				QueryParam("order", "Order of the images", Schema{"type": "string", "enum": []string{"asc", "desc"}, "default": "asc"}),
+			},
+			ContentType: "application/json",
+			Schema:      histPageSchema,
+		}},
+		Route{Method: "GET", Path: "/:id<int>/hist/:name", Handler: c.sendHistWebcam, Name: "webcam.frame", Doc: &RouteDoc{
+			Summary:     "Get a stored image of a webcam",
+			Params:      append([]ParamDoc{webcamIDParam, PathParam("name", "Name of the image, as listed in the history")}, resizeParams...),
+			ContentType: "image/*",
+		}},
+		Route{Method: "GET", Path: "/:id<int>/preview.gif", Handler: c.sendPreview, Name: "webcam.preview", Doc: &RouteDoc{
+			Summary: "Get an animation of the latest stored images of a webcam",
+			Params: []ParamDoc{
+				webcamIDParam,
+				QueryParam("frames", "Number of images in the animation", Schema{"type": "integer", "minimum": 1, "maximum": maxPreviewFrames, "default": defaultPreviewFrames}),
+			},
+			ContentType: "image/gif",
+		}},
+		Route{Method: "GET", Path: "/:id<int>/at", Handler: c.sendFrameAt, Name: "webcam.at", Doc: &RouteDoc{
+			Summary: "Get the stored image of a webcam closest to a time",
+			Params: []ParamDoc{
+				webcamIDParam,
+				ParamDoc{"t", "query", "Time of the image", true, Schema{"type": "string", "format": "date-time"}},
+				QueryParam("mode", "Whether to look for the nearest image or the closest one before or after t", Schema{"type": "string", "enum": []string{matchNearest, matchBefore, matchAfter}, "default": matchNearest}),
+				QueryParam("tolerance", "Maximum distance between t and the time of the image, as a duration such as 5m", nil),
+			},
+			ContentType: "image/*",
+		}},
 	}
 }
 
 func (c *WebcamController) sendWebcamList(w http.ResponseWriter, r *http.Request, p PathParams) error {
 	w.Header().Set("Content-Type", "application/json")
 
-	encoder := json.NewEncoder(w)
-	encoder.Encode(c.webcams)
+	query, err := parseGeoQuery(r.URL.Query())
+	if err != nil {
+		return err
+	}
 
-	return nil
+	grant := GrantFromRequest(r)
+
+	if query == nil {
+		webcams := make([]Webcam, 0, len(c.webcams))
+		for _, webcam := range c.webcams {
+			if grant.CanSee(&webcam) {
+				webcams = append(webcams, webcam)
+			}
+		}
+
+		return json.NewEncoder(w).Encode(webcams)
+	}
+
+	index := c.index
+	if index == nil {
+		index = newSpatialIndex(c.webcams)
+	}
+
+	webcams := []webcamListEntry{}
+	for _, result := range query.apply(index) {
+		webcam := index.webcams[result.index]
+		if !grant.CanSee(&webcam) {
+			continue
+		}
+
+		entry := webcamListEntry{Webcam: webcam}
+		if query.near != nil {
+			d := math.Round(result.distance*1000) / 1000
+			entry.Distance = &d
+		}
+		webcams = append(webcams, entry)
+	}
+
+	return json.NewEncoder(w).Encode(webcams)
+}
+
+// A webcamListEntry is a webcam listed by a geographic query, with its
+// distance in kilometers to the position of the query, if any.
+type webcamListEntry struct {
+	Webcam
+	Distance *float64 `json:"distance,omitempty"`
 }
 
 func (c *WebcamController) sendWebcam(w http.ResponseWriter, r *http.Request, p PathParams) error {
-	webcam, err := c.getWebcam(p["id"], w)
+	webcam, err := c.getWebcam(r, p)
+	if err != nil {
+		return err
+	}
+
+	opts, err := parseResizeOptions(r.URL.Query())
 	if err != nil {
 		return err
 	}
 
-	imageBytes, err := webcam.getImage(&c.client)
+	imageBytes, _, err := webcam.getImageContext(r.Context(), &c.client)
 	if err != nil {
 		return StatusError{http.StatusBadGateway, err}
 	}
 
-	w.Header().Add("Content-Type", "image/jpeg")
+	if opts != nil {
+		imageBytes, err = resizeBytes(imageBytes, opts)
+		if err != nil {
+			return StatusError{http.StatusBadGateway, errors.New("Could not decode webcam image: " + err.Error())}
+		}
+	}
+
+	contentType := "image/jpeg"
+	if opts == nil {
+		if format, err := detectImageFormat(imageBytes); err == nil {
+			contentType = contentTypeFromName(imageExtensions[format])
+		}
+	}
+
+	w.Header().Add("Content-Type", contentType)
 	w.Write(imageBytes)
 
 	return nil
 }
 
-func (c *WebcamController) sendHist(w http.ResponseWriter, r *http.Request, p PathParams) error {
-	w.Header().Set("Content-Type", "application/json")
+// A histEntry describes a stored frame in the history listing.
+type histEntry struct {
+	Name        string    `json:"name"`
+	Time        time.Time `json:"time"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	URL         string    `json:"url"`
+}
 
-	hist := []string{}
-	encoder := json.NewEncoder(w)
+// A histPage is a page of the history listing.
+type histPage struct {
+	Frames []histEntry `json:"frames"`
+	Next   string      `json:"next,omitempty"`
+}
 
+func (c *WebcamController) sendHist(w http.ResponseWriter, r *http.Request, p PathParams) error {
 	// Check that webcam exists
-	if _, err := c.getWebcam(p["id"], w); err != nil {
+	if _, err := c.getWebcam(r, p); err != nil {
 		return err
 	}
 
-	path := filepath.Join(c.storagePath, p["id"])
-	files, err := ioutil.ReadDir(path)
+	query, err := parseHistoryQuery(r.URL.Query(), c.getTimeFormat())
 	if err != nil {
-		fmt.Printf("Unable to read directory %s: %s\n", path, err)
-		encoder.Encode(hist)
-		return nil
+		return err
 	}
 
-	for _, f := range files {
-		hist = append(hist, f.Name())
+	frames, err := c.storedFrames(p["id"])
+	if err != nil {
+		fmt.Printf("Unable to read history of webcam %s: %s\n", p["id"], err)
+	}
+
+	selected, next := query.apply(frames)
+
+	hist := histPage{make([]histEntry, 0, len(selected)), next}
+	for _, f := range selected {
+		hist.Frames = append(hist.Frames, histEntry{
+			f.Name,
+			f.Time,
+			f.Size,
+			contentTypeFromName(f.Name),
+			c.frameURL(r, p["id"], f.Name),
+		})
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
 	encoder.Encode(hist)
+
 	return nil
 }
 
 func (c *WebcamController) sendHistWebcam(w http.ResponseWriter, r *http.Request, p PathParams) error {
 	// Check that webcam exists
-	if _, err := c.getWebcam(p["id"], w); err != nil {
+	if _, err := c.getWebcam(r, p); err != nil {
+		return err
+	}
+
+	opts, err := parseResizeOptions(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	path, err := c.framePath(p["id"], p["name"])
+	if err != nil {
+		return NewProblem(http.StatusNotFound, "Frame not found", err)
+	}
+
+	var imageBytes []byte
+	if opts != nil {
+		imageBytes, err = readThumbnail(filepath.Dir(path), filepath.Base(path), opts)
+	} else {
+		imageBytes, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return NewProblem(http.StatusNotFound, "Frame not found", errors.New("Unable to read file "+path+" : "+err.Error()))
+	}
+
+	if opts != nil {
+		w.Header().Set("Content-Type", "image/jpeg")
+	} else {
+		w.Header().Set("Content-Type", contentTypeFromName(p["name"]))
+	}
+	w.Write(imageBytes)
+	return nil
+}
+
+func (c *WebcamController) sendPreview(w http.ResponseWriter, r *http.Request, p PathParams) error {
+	// Check that webcam exists
+	if _, err := c.getWebcam(r, p); err != nil {
+		return err
+	}
+
+	count := defaultPreviewFrames
+	if s := r.URL.Query().Get("frames"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPreviewFrames {
+			return StatusError{http.StatusBadRequest, errors.New("Invalid frame count " + s)}
+		}
+		count = n
+	}
+
+	stored, err := c.storedFrames(p["id"])
+	if err != nil || len(stored) == 0 {
+		return StatusError{http.StatusNotFound, errNoFrames}
+	}
+
+	if len(stored) > count {
+		stored = stored[len(stored)-count:]
+	}
+
+	frames := make([]string, len(stored))
+	for i, f := range stored {
+		frames[i] = f.Name
+	}
+
+	// Only previews of the default length are cached, other lengths are built
+	// from the cached thumbnails on each request
+	cached := count == defaultPreviewFrames
+
+	var data []byte
+	var ok bool
+	if cached {
+		data, ok = c.previews.get(p["id"], frames)
+	}
+
+	if !ok {
+		data, err = buildPreview(filepath.Join(c.storagePath, p["id"]), frames)
+		if err == errNoFrames {
+			return StatusError{http.StatusNotFound, err}
+		}
+		if err != nil {
+			return err
+		}
+
+		if cached {
+			c.previews.set(p["id"], frames, data)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Write(data)
+
+	return nil
+}
+
+func (c *WebcamController) sendFrameAt(w http.ResponseWriter, r *http.Request, p PathParams) error {
+	// Check that webcam exists
+	if _, err := c.getWebcam(r, p); err != nil {
 		return err
 	}
 
-	path := filepath.Join(c.storagePath, p["id"], p["name"])
-	imageBytes, err := ioutil.ReadFile(path)
+	query := r.URL.Query()
+
+	t, err := time.Parse(time.RFC3339, query.Get("t"))
+	if err != nil {
+		return StatusError{http.StatusBadRequest, errors.New("Invalid time " + query.Get("t") + ", expected RFC 3339")}
+	}
+
+	mode := query.Get("mode")
+	switch mode {
+	case "":
+		mode = matchNearest
+	case matchNearest, matchBefore, matchAfter:
+	default:
+		return StatusError{http.StatusBadRequest, errors.New("Unknown mode " + mode)}
+	}
+
+	var tolerance time.Duration
+	if s := query.Get("tolerance"); s != "" {
+		if tolerance = myParseDuration(s); tolerance <= 0 {
+			return StatusError{http.StatusBadRequest, errors.New("Invalid tolerance " + s)}
+		}
+	}
+
+	frames, err := c.storedFrames(p["id"])
+	if err != nil {
+		return StatusError{http.StatusNotFound, errNoFrames}
+	}
+
+	frame, ok := findFrame(frames, t, mode, tolerance)
+	if !ok {
+		return StatusError{http.StatusNotFound, errors.New("No frame found " + mode + " " + t.Format(time.RFC3339))}
+	}
+
+	imageBytes, err := ioutil.ReadFile(filepath.Join(c.storagePath, p["id"], frame.Name))
 	if err != nil {
-		return StatusError{http.StatusNotFound, errors.New("Unable to read file " + path + " : " + err.Error())}
+		return NewProblem(http.StatusNotFound, "No frame "+frame.Name+" for webcam "+p["id"], err)
 	}
 
+	w.Header().Set("Content-Type", contentTypeFromName(frame.Name))
+	w.Header().Set("Content-Location", c.frameURL(r, p["id"], frame.Name))
+	w.Header().Set("Last-Modified", frame.Time.UTC().Format(http.TimeFormat))
 	w.Write(imageBytes)
+
 	return nil
 }
 
-func (c *WebcamController) getWebcam(id string, w http.ResponseWriter) (*Webcam, error) {
-	webcamID, err := strconv.Atoi(id)
+// frameURL returns the URL of a stored frame. Without URL builder, the URL is
+// derived from the path of the request, which must be a sibling of the history route.
+func (c *WebcamController) frameURL(r *http.Request, id string, name string) string {
+	if c.urls != nil {
+		if u, err := c.urls.URL("webcam.frame", PathParams{"id": id, "name": name}); err == nil {
+			return u
+		}
+	}
+
+	return path.Join(path.Dir(r.URL.Path), "hist", url.PathEscape(name))
+}
+
+// getTimeFormat returns the format of the timestamps in stored image names.
+func (c *WebcamController) getTimeFormat() string {
+	if c.timeFormat == "" {
+		return defaultTimeFormat
+	}
+	return c.timeFormat
+}
+
+// framePath returns the path of a stored frame given its name. Only names of
+// regular image files in the folder of the webcam, as written by the crawler,
+// are accepted.
+func (c *WebcamController) framePath(id string, name string) (string, error) {
+	if name != filepath.Base(name) || strings.ContainsAny(name, "/\\\x00") {
+		return "", errors.New("Invalid frame name " + strconv.Quote(name))
+	}
+
+	if _, err := frameTime(name, c.getTimeFormat()); err != nil {
+		return "", errors.New("Invalid frame name " + strconv.Quote(name) + ": " + err.Error())
+	}
+
+	if _, ok := contentTypes[strings.ToLower(filepath.Ext(name))]; !ok {
+		return "", errors.New("Invalid frame extension in " + strconv.Quote(name))
+	}
+
+	dirname := filepath.Join(c.storagePath, id)
+	path := filepath.Join(dirname, name)
+	if rel, err := filepath.Rel(dirname, path); err != nil || rel != name {
+		return "", errors.New("Frame " + strconv.Quote(name) + " is outside of " + dirname)
+	}
+
+	// Reject symbolic links, which could point outside of the storage folder
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", errors.New("Frame " + path + " is not a regular file")
+	}
+
+	return path, nil
+}
+
+// storedFrames returns the images stored for a webcam, oldest first.
+func (c *WebcamController) storedFrames(id string) ([]storedFrame, error) {
+	return c.history.frames(filepath.Join(c.storagePath, id), c.getTimeFormat())
+}
+
+// getWebcam returns the webcam identified in the path, if visible to the client.
+func (c *WebcamController) getWebcam(r *http.Request, p PathParams) (*Webcam, error) {
+	webcamID, err := p.Int("id")
 	if err != nil {
-		return nil, StatusError{http.StatusNotFound, errors.New("Cuuld not convert " + id + " to webcam id")}
+		return nil, err
 	}
 
+	grant := GrantFromRequest(r)
 	for _, w := range c.webcams {
-		if w.ID == webcamID {
+		// Private webcams are reported as missing, not to reveal their existence
+		if w.ID == webcamID && grant.CanSee(&w) {
 			return &w, nil
 		}
 	}
 
-	return nil, StatusError{http.StatusNotFound, errors.New("Could not find webcam with id " + id)}
+	return nil, StatusError{http.StatusNotFound, errors.New("Could not find webcam with id " + p["id"])}
 }
+
+// Documentation of the routes of the controller.
+var (
+	webcamIDParam = PathParam("id", "Identifier of the webcam")
+
+	resizeParams = []ParamDoc{
+		QueryParam("w", "Maximum width of the image", Schema{"type": "integer", "minimum": 1, "maximum": maxResizeDimension}),
+		QueryParam("h", "Maximum height of the image", Schema{"type": "integer", "minimum": 1, "maximum": maxResizeDimension}),
+		QueryParam("fit", "How the image fits in the requested size", Schema{"type": "string", "enum": []string{fitContain, fitCover, fitFill}, "default": fitContain}),
+	}
+
+	webcamSchema = Schema{
+		"type": "object",
+		"properties": Schema{
+			"id":   Schema{"type": "integer"},
+			"name": Schema{"type": "string"},
+			"URL":  Schema{"type": "string"},
+			"position": Schema{
+				"type": "object",
+				"properties": Schema{
+					"lat": Schema{"type": "number"},
+					"lon": Schema{"type": "number"},
+				},
+			},
+			"crawlInterval": Schema{"type": "string"},
+			"maxAge":        Schema{"type": "string"},
+			"storageFormat": Schema{"type": "string", "enum": []string{storeOriginal, storeJPEG, storePNG}},
+			"jpegQuality":   Schema{"type": "integer"},
+			"private":       Schema{"type": "boolean"},
+			"schedule": Schema{
+				"type": "object",
+				"properties": Schema{
+					"cron":     Schema{"type": "string"},
+					"timezone": Schema{"type": "string"},
+					"interval": Schema{"type": "string"},
+					"windows": Schema{
+						"type": "array",
+						"items": Schema{
+							"type": "object",
+							"properties": Schema{
+								"from":     Schema{"type": "string"},
+								"to":       Schema{"type": "string"},
+								"interval": Schema{"type": "string"},
+							},
+						},
+					},
+				},
+			},
+			"daylight": Schema{
+				"type": "object",
+				"properties": Schema{
+					"sunElevation":  Schema{"type": "number"},
+					"nightInterval": Schema{"type": "string"},
+				},
+			},
+		},
+	}
+
+	histPageSchema = Schema{
+		"type": "object",
+		"properties": Schema{
+			"frames": Schema{
+				"type": "array",
+				"items": Schema{
+					"type": "object",
+					"properties": Schema{
+						"name":        Schema{"type": "string"},
+						"time":        Schema{"type": "string", "format": "date-time"},
+						"size":        Schema{"type": "integer"},
+						"contentType": Schema{"type": "string"},
+						"url":         Schema{"type": "string"},
+					},
+				},
+			},
+			"next": Schema{"type": "string", "description": "Cursor of the next page, absent on the last page"},
+		},
+	}
+)
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var secretData = []byte("top secret content")
+
+func TestHistWebcamPathTraversal(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	storagePath := filepath.Join(root, "hist")
+	frame := "2026-10-17T08:00:00Z.png"
+
+	os.MkdirAll(filepath.Join(storagePath, "1"), os.ModePerm)
+	os.MkdirAll(filepath.Join(storagePath, "2"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(storagePath, "1", frame), imageData, 0644)
+	ioutil.WriteFile(filepath.Join(storagePath, "2", frame), imageData, 0644)
+	ioutil.WriteFile(filepath.Join(root, "secret.txt"), secretData, 0644)
+	ioutil.WriteFile(filepath.Join(root, "2026-10-17T09:00:00Z.png"), secretData, 0644)
+	os.Symlink(filepath.Join(root, "2026-10-17T09:00:00Z.png"), filepath.Join(storagePath, "1", "2026-10-17T10:00:00Z.png"))
+
+	controller := &WebcamController{storagePath: storagePath}
+	controller.SetWebcams([]Webcam{
+		Webcam{ID: 1, Name: "Public"},
+		Webcam{ID: 2, Name: "Private", Private: true},
+	})
+
+	router := NewRouter(nil)
+	router.Mount("/webcam", controller)
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/webcam/1/hist/" + frame, 200},
+		{"/webcam/1/hist/" + frame + "?w=2", 200},
+		{"/webcam/1/hist/../../secret.txt", 0},
+		{"/webcam/1/hist/..%2F..%2Fsecret.txt", 0},
+		{"/webcam/1/hist/..%2F..%2F2026-10-17T09:00:00Z.png", 0},
+		{"/webcam/1/hist/..%5C..%5Csecret.txt", 404},
+		{"/webcam/1/hist/..%5C2%5C" + frame, 404},
+		{"/webcam/1/hist/%2e%2e", 404},
+		{"/webcam/1/hist/.", 404},
+		{"/webcam/1/hist/secret.txt", 404},
+		{"/webcam/1/hist/2026-10-17T08:00:00Z.txt", 404},
+		{"/webcam/1/hist/2026-10-17T08:00:00Z%00.png", 404},
+		{"/webcam/1/hist/2026-10-17T10:00:00Z.png", 404},
+		{"/webcam/1/hist/2026-10-17T10:00:00Z.png?w=2", 404},
+		{"/webcam/1/hist/" + thumbnailDir, 404},
+		{"/webcam/2/hist/" + frame, 404},
+		{"/webcam/1/hist/%2F" + strings.TrimPrefix(root, "/") + "%2Fsecret.txt", 0},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		body := rec.Body.String()
+
+		// 0 means that no route must match, the router then sends an empty response
+		if test.expected == 0 && (rec.Code != 200 || body != "") {
+			t.Errorf("%s: expected no matching route, got %d %s\n", test.path, rec.Code, body)
+		}
+		if test.expected != 0 && rec.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d\n", test.path, test.expected, rec.Code)
+		}
+
+		if strings.Contains(body, string(secretData)) || strings.Contains(body, root) {
+			t.Errorf("%s: response leaks %s\n", test.path, body)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dirname := filepath.Join(root, "1")
+	os.MkdirAll(dirname, os.ModePerm)
+
+	buf := new(bytes.Buffer)
+	png.Encode(buf, image.NewGray(image.Rect(0, 0, 800, 450)))
+	for _, name := range []string{"2026-10-17T08:00:00Z.png", "2026-10-17T08:05:00Z.png", "2026-10-17T08:10:00Z.png"} {
+		ioutil.WriteFile(filepath.Join(dirname, name), buf.Bytes(), 0644)
+	}
+
+	controller := &WebcamController{storagePath: root}
+	controller.SetWebcams([]Webcam{Webcam{ID: 1, Name: "Les Paccots"}})
+
+	router := NewRouter(nil)
+	router.Mount("/webcam", controller)
+
+	getPreview := func(query string) []byte {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/webcam/1/preview.gif"+query, nil))
+		if rec.Code != 200 || rec.Header().Get("Content-Type") != "image/gif" {
+			t.Fatalf("Expected a GIF, got %d %s\n", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		return rec.Body.Bytes()
+	}
+
+	checkPreview := func(data []byte, frames int) {
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Invalid preview: %s\n", err)
+		}
+		if len(anim.Image) != frames {
+			t.Errorf("Expected %d frames, got %d\n", frames, len(anim.Image))
+		}
+		for _, img := range anim.Image {
+			if b := img.Bounds(); b.Dx() > previewMaxWidth || b.Dy() > previewMaxHeight {
+				t.Errorf("Expected frames of at most %dx%d, got %dx%d\n", previewMaxWidth, previewMaxHeight, b.Dx(), b.Dy())
+			}
+		}
+	}
+
+	first := getPreview("")
+	checkPreview(first, 3)
+
+	// The preview is cached until a new frame is stored
+	for key, entry := range controller.previews.entries {
+		entry.data = []byte("cached")
+		controller.previews.entries[key] = entry
+	}
+	if data := getPreview(""); string(data) != "cached" {
+		t.Errorf("Expected the cached preview, got %d bytes\n", len(data))
+	}
+	if _, err := os.Stat(thumbnailPath(dirname, "2026-10-17T08:00:00Z.png", &previewSize)); err != nil {
+		t.Errorf("Expected the preview to be built from thumbnails: %s\n", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dirname, "2026-10-17T08:15:00Z.png"), buf.Bytes(), 0644)
+
+	checkPreview(getPreview(""), 4)
+
+	// Only previews of the default length are cached
+	checkPreview(getPreview("?frames=2"), 2)
+	if len(controller.previews.entries) != 1 {
+		t.Errorf("Expected one cached preview, got %d\n", len(controller.previews.entries))
+	}
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 )
 
-var imageData = []byte{'T', 'e', 's', 't', '!'}
+var imageData = testImage()
+
+// testImage returns a small encoded PNG image.
+func testImage() []byte {
+	buf := new(bytes.Buffer)
+	png.Encode(buf, image.NewGray(image.Rect(0, 0, 4, 3)))
+	return buf.Bytes()
+}
 
 type testHandler struct{}
 
@@ -22,12 +32,12 @@ func TestWebcamGetImage(t *testing.T) {
 	addr := "http://" + server.Listener.Addr().String()
 
 	webcam := &Webcam{
-		1,
-		"Les Paccots",
-		addr,
-		Coordinate{46.123, 6.66},
-		"10",
-		"3ms",
+		ID:                  1,
+		Name:                "Les Paccots",
+		URL:                 addr,
+		Position:            Coordinate{46.123, 6.66},
+		CrawlIntervalString: "10",
+		MaxAgeString:        "3ms",
 	}
 
 	img, err := webcam.getImage(server.Client())
@@ -56,12 +66,12 @@ func compare(x, y []byte) bool {
 
 func TestWebcamDurationParsing(t *testing.T) {
 	webcam := &Webcam{
-		1,
-		"Les Paccots",
-		"",
-		Coordinate{46.123, 6.66},
-		"10",
-		"3ms",
+		ID:                  1,
+		Name:                "Les Paccots",
+		URL:                 "",
+		Position:            Coordinate{46.123, 6.66},
+		CrawlIntervalString: "10",
+		MaxAgeString:        "3ms",
 	}
 
 	if webcam.CrawlInterval() != 10*time.Second {
@@ -75,12 +85,12 @@ func TestWebcamDurationParsing(t *testing.T) {
 
 func TestWebcamInvalidDurationParsing(t *testing.T) {
 	webcam := &Webcam{
-		1,
-		"Les Paccots",
-		"",
-		Coordinate{46.123, 6.66},
-		"hahaha",
-		"3ms",
+		ID:                  1,
+		Name:                "Les Paccots",
+		URL:                 "",
+		Position:            Coordinate{46.123, 6.66},
+		CrawlIntervalString: "hahaha",
+		MaxAgeString:        "3ms",
 	}
 
 	if webcam.CrawlInterval() != 0 {